@@ -0,0 +1,168 @@
+package tapcards
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// ScriptType is a standard script type a slot key can receive funds on.
+type ScriptType int
+
+const (
+	// P2WPKH is native SegWit, the address type the card reports.
+	P2WPKH ScriptType = iota
+	// P2SHP2WPKH is SegWit nested in pay to script hash.
+	P2SHP2WPKH
+	// P2PKH is legacy pay to public key hash.
+	P2PKH
+)
+
+// scriptTypes are the script types derived for a slot key, starting with the one the card reports.
+var scriptTypes = []ScriptType{P2WPKH, P2SHP2WPKH, P2PKH}
+
+func (scriptType ScriptType) String() string {
+
+	switch scriptType {
+	case P2WPKH:
+		return "p2wpkh"
+	case P2SHP2WPKH:
+		return "p2sh-p2wpkh"
+	case P2PKH:
+		return "p2pkh"
+	default:
+		return "unknown"
+	}
+
+}
+
+// SlotAddress is an address a slot key could have received funds on.
+type SlotAddress struct {
+	// Type is the script type of the address.
+	Type ScriptType
+	// Address is the encoded address.
+	Address string
+	// Script is the output script paying to the address.
+	Script []byte
+	// ScriptHash is the Electrum script hash of the output script, used to look up its balance and history
+	// on Electrum servers.
+	ScriptHash string
+}
+
+// SlotAddresses returns every standard address the public key of a slot could have received funds on,
+// starting with the P2WPKH address the card reports. The public key of a sealed slot is known once it
+// has been read. If params is nil, mainnet is used.
+func (satscard *Satscard) SlotAddresses(slot int, params *chaincfg.Params) ([]SlotAddress, error) {
+
+	if slot < 0 || slot >= len(satscard.slots) {
+		return nil, fmt.Errorf("no such slot: %d", slot)
+	}
+
+	publicKey := satscard.slots[slot].publicKey
+
+	if publicKey == [33]byte{} {
+		return nil, fmt.Errorf("public key of slot %d is not known", slot)
+	}
+
+	return PublicKeyAddresses(publicKey[:], params)
+
+}
+
+// PublicKeyAddresses returns every standard address of a compressed public key, as done by SlotAddresses.
+func PublicKeyAddresses(publicKey []byte, params *chaincfg.Params) ([]SlotAddress, error) {
+
+	if params == nil {
+		params = &chaincfg.MainNetParams
+	}
+
+	// Funds sent to the addresses of anything else could never be spent
+	if _, err := btcec.ParsePubKey(publicKey); err != nil || len(publicKey) != btcec.PubKeyBytesLenCompressed {
+		return nil, fmt.Errorf("invalid compressed public key: %x", publicKey)
+	}
+
+	addresses := make([]SlotAddress, 0, len(scriptTypes))
+
+	for _, scriptType := range scriptTypes {
+
+		address, err := scriptAddress(scriptType, publicKey, params)
+
+		if err != nil {
+			return nil, err
+		}
+
+		script, err := txscript.PayToAddrScript(address)
+
+		if err != nil {
+			return nil, err
+		}
+
+		addresses = append(addresses, SlotAddress{
+			Type:       scriptType,
+			Address:    address.EncodeAddress(),
+			Script:     script,
+			ScriptHash: electrumScriptHash(script),
+		})
+
+	}
+
+	return addresses, nil
+
+}
+
+// scriptAddress returns the address of the given script type for a public key.
+func scriptAddress(scriptType ScriptType, publicKey []byte, params *chaincfg.Params) (btcutil.Address, error) {
+
+	hash160 := btcutil.Hash160(publicKey)
+
+	switch scriptType {
+	case P2WPKH:
+		return btcutil.NewAddressWitnessPubKeyHash(hash160, params)
+	case P2SHP2WPKH:
+
+		redeemScript, err := witnessPubKeyHashScript(publicKey, params)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return btcutil.NewAddressScriptHash(redeemScript, params)
+
+	case P2PKH:
+		return btcutil.NewAddressPubKeyHash(hash160, params)
+	default:
+		return nil, fmt.Errorf("unknown script type: %v", scriptType)
+	}
+
+}
+
+// outputScript returns the output script of the given script type for a public key.
+func outputScript(scriptType ScriptType, publicKey []byte, params *chaincfg.Params) ([]byte, error) {
+
+	address, err := scriptAddress(scriptType, publicKey, params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return txscript.PayToAddrScript(address)
+
+}
+
+// electrumScriptHash returns the script hash Electrum servers index an output script by,
+// the SHA256 of the script in reverse byte order.
+func electrumScriptHash(script []byte) string {
+
+	hash := sha256.Sum256(script)
+
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+
+	return hex.EncodeToString(hash[:])
+
+}
@@ -0,0 +1,115 @@
+package tapcards
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// generatorPublicKey is the compressed public key of private key 1, the generator point of secp256k1.
+const generatorPublicKey = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+
+func TestPublicKeyAddresses(t *testing.T) {
+
+	// The well-known addresses of the generator point, with their scripts and Electrum script hashes
+	mainnet := []SlotAddress{
+		{
+			Type:       P2WPKH,
+			Address:    "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+			Script:     unhex(t, "0014751e76e8199196d454941c45d1b3a323f1433bd6"),
+			ScriptHash: "9623df75239b5daa7f5f03042d325b51498c4bb7059c7748b17049bf96f73888",
+		},
+		{
+			Type:       P2SHP2WPKH,
+			Address:    "3JvL6Ymt8MVWiCNHC7oWU6nLeHNJKLZGLN",
+			Script:     unhex(t, "a914bcfeb728b584253d5f3f70bcb780e9ef218a68f487"),
+			ScriptHash: "fdc7d5e92a18f7d2ed38bbc0828dc1487c9ccbb58fe3c082c87e7d39f378ab69",
+		},
+		{
+			Type:       P2PKH,
+			Address:    "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH",
+			Script:     unhex(t, "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac"),
+			ScriptHash: "8bd2c4f79944cd6a3cb1730cf92c513ae259eb271d81918457f3753eebe14a3f",
+		},
+	}
+
+	// The scripts and script hashes do not depend on the network
+	testnet := []SlotAddress{mainnet[0], mainnet[1], mainnet[2]}
+	testnet[0].Address = "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx"
+	testnet[1].Address = "2NAUYAHhujozruyzpsFRP63mbrdaU5wnEpN"
+	testnet[2].Address = "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r"
+
+	tests := []struct {
+		name   string
+		params *chaincfg.Params
+		want   []SlotAddress
+	}{
+		{"default", nil, mainnet},
+		{"mainnet", &chaincfg.MainNetParams, mainnet},
+		{"testnet", &chaincfg.TestNet3Params, testnet},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			addresses, err := PublicKeyAddresses(unhex(t, generatorPublicKey), test.params)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(addresses, test.want) {
+				t.Errorf("addresses = %+v, want %+v", addresses, test.want)
+			}
+
+		})
+	}
+
+}
+
+func TestElectrumScriptHash(t *testing.T) {
+
+	// The example of the Electrum protocol, the P2PKH script of 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa
+	script := unhex(t, "76a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1888ac")
+
+	if scriptHash := electrumScriptHash(script); scriptHash != "8b01df4e368ea28f8dc0423bcf7a4923e3a12d307c875e47a0cfbf90b5c39161" {
+		t.Errorf("script hash = %s", scriptHash)
+	}
+
+}
+
+func TestSlotAddresses(t *testing.T) {
+
+	var publicKey [33]byte
+	copy(publicKey[:], unhex(t, transcriptSlotPublicKey))
+
+	satscard := Satscard{slots: []slot{{state: SlotSealed, publicKey: publicKey}, {state: SlotUnused}}}
+
+	addresses, err := satscard.SlotAddresses(0, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first address is the one the card reports
+	if len(addresses) != 3 || addresses[0].Type != P2WPKH || addresses[0].Address != transcriptAddress {
+		t.Errorf("addresses = %+v", addresses)
+	}
+
+	for _, slot := range []int{1, 2, -1} {
+		if _, err := satscard.SlotAddresses(slot, nil); err == nil {
+			t.Errorf("addresses of slot %d returned", slot)
+		}
+	}
+
+	// An uncompressed key has other addresses than the card's, and anything else has none
+	uncompressed := unhex(t, "0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8")
+
+	for _, publicKey := range [][]byte{nil, {0x02, 0x01}, uncompressed} {
+		if _, err := PublicKeyAddresses(publicKey, nil); err == nil {
+			t.Errorf("addresses of %x returned", publicKey)
+		}
+	}
+
+}
@@ -1,13 +1,76 @@
 package tapcards
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/fxamacker/cbor/v2"
 	"github.com/skythen/apdu"
 )
 
+// ISO 7816-4 status words reported by the card or the reader.
+var (
+	// ErrWrongLength is reported as 6700.
+	ErrWrongLength = errors.New("wrong length")
+	// ErrSecurityStatusNotSatisfied is reported as 6982.
+	ErrSecurityStatusNotSatisfied = errors.New("security status not satisfied")
+	// ErrConditionsNotSatisfied is reported as 6985.
+	ErrConditionsNotSatisfied = errors.New("conditions of use not satisfied")
+	// ErrWrongData is reported as 6A80.
+	ErrWrongData = errors.New("incorrect data")
+	// ErrFunctionNotSupported is reported as 6A81.
+	ErrFunctionNotSupported = errors.New("function not supported")
+	// ErrFileNotFound is reported as 6A82, typically when the applet is not present on the card.
+	ErrFileNotFound = errors.New("file or application not found")
+	// ErrIncorrectParameters is reported as 6A86 or 6B00.
+	ErrIncorrectParameters = errors.New("incorrect parameters P1-P2")
+	// ErrInstructionNotSupported is reported as 6D00.
+	ErrInstructionNotSupported = errors.New("instruction not supported")
+	// ErrClassNotSupported is reported as 6E00.
+	ErrClassNotSupported = errors.New("class not supported")
+	// ErrNoPreciseDiagnosis is reported as 6F00.
+	ErrNoPreciseDiagnosis = errors.New("no precise diagnosis")
+)
+
+// statusWords maps the status words with a known meaning to their errors.
+var statusWords = map[uint16]error{
+	0x6700: ErrWrongLength,
+	0x6982: ErrSecurityStatusNotSatisfied,
+	0x6985: ErrConditionsNotSatisfied,
+	0x6A80: ErrWrongData,
+	0x6A81: ErrFunctionNotSupported,
+	0x6A82: ErrFileNotFound,
+	0x6A86: ErrIncorrectParameters,
+	0x6B00: ErrIncorrectParameters,
+	0x6D00: ErrInstructionNotSupported,
+	0x6E00: ErrClassNotSupported,
+	0x6F00: ErrNoPreciseDiagnosis,
+}
+
+// StatusWordError is returned when a response APDU carries a status word other than 9000.
+// It matches the corresponding ErrXxx value with errors.Is.
+type StatusWordError struct {
+	SW1 byte
+	SW2 byte
+}
+
+func (err *StatusWordError) Error() string {
+
+	if known := err.Unwrap(); known != nil {
+		return fmt.Sprintf("status word %02X%02X: %v", err.SW1, err.SW2, known)
+	}
+
+	return fmt.Sprintf("incorrect status word: %02X%02X", err.SW1, err.SW2)
+
+}
+
+// Unwrap returns the error for the status word, or nil if it has no known meaning.
+func (err *StatusWordError) Unwrap() error {
+	return statusWords[uint16(err.SW1)<<8|uint16(err.SW2)]
+}
+
 // apduWrap takes any value, serializes it using CBOR, and wraps it into an APDU command.
+// Payloads longer than 255 bytes are encoded as extended length APDUs.
 // It returns the byte representation of the APDU command or an error if something goes wrong.
 func apduWrap(value interface{}) ([]byte, error) {
 
@@ -22,21 +85,69 @@ func apduWrap(value interface{}) ([]byte, error) {
 
 }
 
-// apduUnwrap takes a byte slice, tries to parse it as an APDU response, and returns the data field of the response.
-// It returns an error if the byte slice cannot be parsed as an APDU response.
-func apduUnwrap(value []byte) ([]byte, error) {
+// unwrapResponse handles the ISO 7816-4 response chaining of a response APDU.
+//
+// On 61xx the card has more data available, and a GET RESPONSE request is returned to fetch it.
+// On 6Cxx the card expects a different Le, and the last request is returned again with it.
+// Otherwise the data of the whole chain is returned, or an error for a status word other than 9000.
+func (satscard *Satscard) unwrapResponse(response []byte) (data []byte, request []byte, err error) {
 
-	rapdu, err := apdu.ParseRapdu(value)
+	rapdu, err := apdu.ParseRapdu(response)
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	switch rapdu.SW1 {
+
+	case 0x61:
 
+		satscard.responseChain = append(satscard.responseChain, rapdu.Data...)
+
+		getResponse := apdu.Capdu{Cla: 0x00, Ins: 0xC0, P1: 0x00, P2: 0x00, Ne: expectedLength(rapdu.SW2)}
+
+		request, err = getResponse.Bytes()
+
+		return nil, request, err
+
+	case 0x6C:
+
+		if satscard.lastRequest == nil {
+			return nil, nil, &StatusWordError{SW1: rapdu.SW1, SW2: rapdu.SW2}
+		}
+
+		capdu, err := apdu.ParseCapdu(satscard.lastRequest)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		capdu.Ne = expectedLength(rapdu.SW2)
+
+		request, err = capdu.Bytes()
+
+		return nil, request, err
+
+	}
+
+	data = append(satscard.responseChain, rapdu.Data...)
+	satscard.responseChain = nil
+
+	if rapdu.SW1 != 0x90 || rapdu.SW2 != 0x00 {
+		return nil, nil, &StatusWordError{SW1: rapdu.SW1, SW2: rapdu.SW2}
 	}
 
-	if rapdu.SW1 != 0x90 {
-		return nil, fmt.Errorf("incorrect status word 1: %x", rapdu.SW1)
+	return data, nil, nil
+
+}
+
+// expectedLength converts the length in SW2 of 61xx and 6Cxx into Ne, where 00 means 256.
+func expectedLength(sw2 byte) int {
+
+	if sw2 == 0 {
+		return apdu.MaxLenResponseDataStandard
 	}
 
-	return rapdu.Data, nil
+	return int(sw2)
 
 }
@@ -0,0 +1,221 @@
+package tapcards
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUnwrapResponseChaining(t *testing.T) {
+
+	// exchange is a response APDU and what unwrapResponse makes of it
+	type exchange struct {
+		response string
+		data     string
+		request  string
+		err      error
+	}
+
+	tests := []struct {
+		name      string
+		exchanges []exchange
+	}{
+		{"single response", []exchange{
+			{response: "a1b2c39000", data: "a1b2c3"},
+		}},
+		{"one GET RESPONSE", []exchange{
+			{response: "a1b26103", request: "00c0000003"},
+			{response: "c3d4e59000", data: "a1b2c3d4e5"},
+		}},
+		{"several GET RESPONSE", []exchange{
+			{response: "a16102", request: "00c0000002"},
+			{response: "b2c36101", request: "00c0000001"},
+			{response: "d49000", data: "a1b2c3d4"},
+		}},
+		{"61 00 asks for 256 bytes", []exchange{
+			{response: "a16100", request: "00c0000000"},
+			{response: "b29000", data: "a1b2"},
+		}},
+		{"chain ending in an error", []exchange{
+			{response: "a16102", request: "00c0000002"},
+			{response: "6a82", err: ErrFileNotFound},
+			// The data of the failed chain is not carried over
+			{response: "c39000", data: "c3"},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			var satscard Satscard
+
+			for i, exchange := range test.exchanges {
+
+				data, request, err := satscard.unwrapResponse(unhex(t, exchange.response))
+
+				if !errors.Is(err, exchange.err) {
+					t.Fatalf("exchange %d: err = %v, want %v", i+1, err, exchange.err)
+				}
+
+				if !bytes.Equal(data, unhex(t, exchange.data)) {
+					t.Errorf("exchange %d: data = %x, want %s", i+1, data, exchange.data)
+				}
+
+				if !bytes.Equal(request, unhex(t, exchange.request)) {
+					t.Errorf("exchange %d: request = %x, want %s", i+1, request, exchange.request)
+				}
+
+			}
+
+		})
+	}
+
+}
+
+func TestUnwrapResponseWrongLength(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		lastRequest string
+		response    string
+		request     string
+	}{
+		{"without Le", "00cb000003a10102", "6c10", "00cb000003a1010210"},
+		{"with Le", "00cb000003a1010220", "6c08", "00cb000003a1010208"},
+		{"6C 00 asks for 256 bytes", "00cb000003a10102", "6c00", "00cb000003a1010200"},
+		{"GET RESPONSE", "00c0000010", "6c04", "00c0000004"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			satscard := Satscard{lastRequest: unhex(t, test.lastRequest)}
+
+			data, request, err := satscard.unwrapResponse(unhex(t, test.response))
+
+			if err != nil || data != nil {
+				t.Fatalf("data %x, err %v", data, err)
+			}
+
+			if !bytes.Equal(request, unhex(t, test.request)) {
+				t.Errorf("request = %x, want %s", request, test.request)
+			}
+
+		})
+	}
+
+	// Without a request to send again, 6Cxx is an error
+	var satscard Satscard
+
+	var statusWordError *StatusWordError
+
+	if _, _, err := satscard.unwrapResponse([]byte{0x6c, 0x10}); !errors.As(err, &statusWordError) || statusWordError.SW1 != 0x6c || statusWordError.SW2 != 0x10 {
+		t.Errorf("err = %v, want status word 6C10", err)
+	}
+
+}
+
+func TestStatusWords(t *testing.T) {
+
+	tests := []struct {
+		response string
+		err      error
+		message  string
+	}{
+		{"6700", ErrWrongLength, "status word 6700: wrong length"},
+		{"6982", ErrSecurityStatusNotSatisfied, "status word 6982: security status not satisfied"},
+		{"6985", ErrConditionsNotSatisfied, "status word 6985: conditions of use not satisfied"},
+		{"6a80", ErrWrongData, "status word 6A80: incorrect data"},
+		{"6a81", ErrFunctionNotSupported, "status word 6A81: function not supported"},
+		{"6a82", ErrFileNotFound, "status word 6A82: file or application not found"},
+		{"6a86", ErrIncorrectParameters, "status word 6A86: incorrect parameters P1-P2"},
+		{"6b00", ErrIncorrectParameters, "status word 6B00: incorrect parameters P1-P2"},
+		{"6d00", ErrInstructionNotSupported, "status word 6D00: instruction not supported"},
+		{"6e00", ErrClassNotSupported, "status word 6E00: class not supported"},
+		{"6f00", ErrNoPreciseDiagnosis, "status word 6F00: no precise diagnosis"},
+		{"6400", nil, "incorrect status word: 6400"},
+		{"a16a82", ErrFileNotFound, "status word 6A82: file or application not found"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.response, func(t *testing.T) {
+
+			var satscard Satscard
+
+			data, request, err := satscard.unwrapResponse(unhex(t, test.response))
+
+			var statusWordError *StatusWordError
+
+			if !errors.As(err, &statusWordError) {
+				t.Fatalf("err = %v, want a StatusWordError", err)
+			}
+
+			if data != nil || request != nil {
+				t.Errorf("data %x and request %x returned with an error", data, request)
+			}
+
+			if statusWordError.Unwrap() != test.err || test.err != nil && !errors.Is(err, test.err) {
+				t.Errorf("err = %v, want %v", err, test.err)
+			}
+
+			if err.Error() != test.message {
+				t.Errorf("message = %q, want %q", err.Error(), test.message)
+			}
+
+		})
+	}
+
+}
+
+func TestParseResponseChained(t *testing.T) {
+
+	card := newSimulatedCard(t)
+	satscard := card.satscard()
+
+	request, err := satscard.StatusRequest()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := card.Transmit(context.Background(), request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The reader hands out the response in chunks of 16 bytes
+	data := response[:len(response)-2]
+
+	for len(data) > 16 {
+
+		remaining := len(data) - 16
+
+		if remaining > 16 {
+			remaining = 16
+		}
+
+		request, err := satscard.ParseResponse(append(append([]byte(nil), data[:16]...), 0x61, byte(remaining)))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := []byte{0x00, 0xc0, 0x00, 0x00, byte(remaining)}; !bytes.Equal(request, want) {
+			t.Fatalf("request = %x, want %x", request, want)
+		}
+
+		data = data[16:]
+
+	}
+
+	if request, err := satscard.ParseResponse(append(append([]byte(nil), data...), 0x90, 0x00)); err != nil || request != nil {
+		t.Fatalf("request %x, err %v", request, err)
+	}
+
+	if satscard.Proto != card.proto || satscard.ActiveSlot != 0 || satscard.Identity == "" {
+		t.Errorf("status not parsed: proto %d, slot %d, identity %q", satscard.Proto, satscard.ActiveSlot, satscard.Identity)
+	}
+
+}
@@ -0,0 +1,237 @@
+package tapcards
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// attestationVersion is the version of the attestation bundle format written by this library.
+const attestationVersion = 1
+
+// ErrInvalidAttestation is returned by VerifyAttestation when an attestation bundle fails any of its checks.
+var ErrInvalidAttestation = errors.New("invalid attestation")
+
+// Attestation is a self-contained record of the responses a card gave to the certs, check and read
+// commands. It can be verified later, without the card, to prove that the slot public key and its
+// address belong to a genuine card. It does not prove when the card was read: the nonces are not
+// bound to the time, so the attestation could have been made at any point.
+type Attestation struct {
+	// Version is the version of the bundle format.
+	Version int `json:"version" cbor:"version"`
+	// Timestamp is the time the attestation was exported, in seconds since the Unix epoch, according to
+	// the clock of the exporting device. It is not covered by any signature and is not checked by
+	// VerifyAttestation, so it is informational only.
+	Timestamp int64 `json:"timestamp" cbor:"timestamp"`
+	// CardPublicKey is the compressed public key of the card.
+	CardPublicKey []byte `json:"card_public_key" cbor:"card_public_key"`
+	// CertificateChain is the certificate chain returned by certs.
+	CertificateChain [][]byte `json:"certificate_chain" cbor:"certificate_chain"`
+	// CheckCardNonce is the card nonce in effect when check was sent.
+	CheckCardNonce []byte `json:"check_card_nonce" cbor:"check_card_nonce"`
+	// CheckAppNonce is the nonce sent by the application with check.
+	CheckAppNonce []byte `json:"check_app_nonce" cbor:"check_app_nonce"`
+	// CheckSignature is the signature returned by check.
+	CheckSignature []byte `json:"check_signature" cbor:"check_signature"`
+	// ReadCardNonce is the card nonce in effect when read was sent.
+	ReadCardNonce []byte `json:"read_card_nonce" cbor:"read_card_nonce"`
+	// ReadAppNonce is the nonce sent by the application with read.
+	ReadAppNonce []byte `json:"read_app_nonce" cbor:"read_app_nonce"`
+	// ReadSignature is the signature returned by read.
+	ReadSignature []byte `json:"read_signature" cbor:"read_signature"`
+	// Slot is the slot that was read.
+	Slot int `json:"slot" cbor:"slot"`
+	// SlotPublicKey is the compressed public key of the slot.
+	SlotPublicKey []byte `json:"slot_public_key" cbor:"slot_public_key"`
+	// Address is the payment address of the slot.
+	Address string `json:"address" cbor:"address"`
+	// StatusAddress is the truncated address reported by status, if any.
+	StatusAddress string `json:"status_address,omitempty" cbor:"status_address,omitempty"`
+}
+
+// ExportAttestation returns a JSON attestation bundle for the card.
+// The certs, read and check commands must have completed, as done by CertsRequest.
+func (satscard *Satscard) ExportAttestation() ([]byte, error) {
+
+	attestation, err := satscard.attestation()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(attestation)
+
+}
+
+// ExportAttestationCBOR returns a CBOR attestation bundle for the card.
+// The certs, read and check commands must have completed, as done by CertsRequest.
+func (satscard *Satscard) ExportAttestationCBOR() ([]byte, error) {
+
+	attestation, err := satscard.attestation()
+	if err != nil {
+		return nil, err
+	}
+
+	return cbor.Marshal(attestation)
+
+}
+
+// attestation builds an attestation from the verification results of the session.
+func (satscard *Satscard) attestation() (*Attestation, error) {
+
+	if satscard.checkChallenge == nil || satscard.readChallenge == nil {
+		return nil, errors.New("card not checked: run CertsRequest first")
+	}
+
+	evidence := satscard.evidence()
+
+	address, err := paymentAddress(evidence.slotPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	attestation := Attestation{
+		Version:        attestationVersion,
+		Timestamp:      time.Now().Unix(),
+		CardPublicKey:  evidence.cardPublicKey[:],
+		CheckCardNonce: evidence.check.cardNonce[:],
+		CheckAppNonce:  evidence.check.appNonce,
+		CheckSignature: evidence.check.signature[:],
+		ReadCardNonce:  evidence.read.cardNonce[:],
+		ReadAppNonce:   evidence.read.appNonce,
+		ReadSignature:  evidence.read.signature[:],
+		Slot:           evidence.slot,
+		SlotPublicKey:  evidence.slotPublicKey[:],
+		Address:        address,
+		StatusAddress:  evidence.statusAddress,
+	}
+
+	for _, certificate := range evidence.certificateChain {
+		attestation.CertificateChain = append(attestation.CertificateChain, append([]byte(nil), certificate[:]...))
+	}
+
+	return &attestation, nil
+
+}
+
+// ParseAttestation decodes an attestation bundle in either JSON or CBOR format.
+func ParseAttestation(bundle []byte) (*Attestation, error) {
+
+	var attestation Attestation
+
+	var err error
+
+	if trimmed := bytes.TrimSpace(bundle); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(trimmed, &attestation)
+	} else {
+		err = cbor.Unmarshal(bundle, &attestation)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if attestation.Version != attestationVersion {
+		return nil, fmt.Errorf("unsupported attestation version: %d", attestation.Version)
+	}
+
+	return &attestation, nil
+
+}
+
+// VerifyAttestation re-runs the checks of the certs, check and read commands on an attestation bundle,
+// without the card. If trustStore is nil, the store returned by DefaultTrustStore is used.
+// The report is returned even when a check fails, together with an error wrapping ErrInvalidAttestation.
+func VerifyAttestation(bundle []byte, trustStore *TrustStore) (*VerificationReport, error) {
+
+	attestation, err := ParseAttestation(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	evidence, err := attestation.evidence()
+	if err != nil {
+		return nil, err
+	}
+
+	if trustStore == nil {
+		trustStore = defaultTrustStore
+	}
+
+	report, err := evidence.verify(trustStore)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case report.FactoryRoot == "":
+		return report, fmt.Errorf("%w: %v", ErrInvalidAttestation, ErrUntrustedFactoryRoot)
+	case !report.CheckSignatureValid:
+		return report, fmt.Errorf("%w: invalid check signature", ErrInvalidAttestation)
+	case !report.ReadSignatureValid:
+		return report, fmt.Errorf("%w: invalid read signature", ErrInvalidAttestation)
+	case !report.SlotPublicKeyCovered:
+		return report, fmt.Errorf("%w: slot public key not covered by check signature", ErrInvalidAttestation)
+	case report.Address != attestation.Address:
+		return report, fmt.Errorf("%w: address does not match slot public key", ErrInvalidAttestation)
+	}
+
+	return report, nil
+
+}
+
+// evidence converts the attestation into evidence, checking the length of every field.
+func (attestation *Attestation) evidence() (evidence, error) {
+
+	var evidence evidence
+
+	check := signedChallenge{appNonce: attestation.CheckAppNonce}
+	read := signedChallenge{appNonce: attestation.ReadAppNonce}
+
+	fields := []struct {
+		name        string
+		destination []byte
+		source      []byte
+	}{
+		{"card public key", evidence.cardPublicKey[:], attestation.CardPublicKey},
+		{"check card nonce", check.cardNonce[:], attestation.CheckCardNonce},
+		{"check signature", check.signature[:], attestation.CheckSignature},
+		{"read card nonce", read.cardNonce[:], attestation.ReadCardNonce},
+		{"read signature", read.signature[:], attestation.ReadSignature},
+		{"slot public key", evidence.slotPublicKey[:], attestation.SlotPublicKey},
+	}
+
+	for _, field := range fields {
+
+		if len(field.source) != len(field.destination) {
+			return evidence, fmt.Errorf("attestation %s: expected %d bytes, got %d", field.name, len(field.destination), len(field.source))
+		}
+
+		copy(field.destination, field.source)
+
+	}
+
+	for i, certificate := range attestation.CertificateChain {
+
+		if len(certificate) != 65 {
+			return evidence, fmt.Errorf("attestation certificate %d: expected 65 bytes, got %d", i, len(certificate))
+		}
+
+		var certificateBytes [65]byte
+		copy(certificateBytes[:], certificate)
+
+		evidence.certificateChain = append(evidence.certificateChain, certificateBytes)
+
+	}
+
+	evidence.check = &check
+	evidence.read = &read
+	evidence.slot = attestation.Slot
+	evidence.statusAddress = attestation.StatusAddress
+
+	return evidence, nil
+
+}
@@ -0,0 +1,241 @@
+package tapcards
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// verifiedCard returns a simulated card and a Satscard that has run certs, read and check on it.
+func verifiedCard(t *testing.T) (*simulatedCard, *Satscard) {
+
+	card := newSimulatedCard(t)
+	satscard := card.satscard()
+
+	if err := card.run(satscard, satscard.CertsRequest); err != nil {
+		t.Fatal(err)
+	}
+
+	return card, satscard
+
+}
+
+func TestAttestationRoundTrip(t *testing.T) {
+
+	card, satscard := verifiedCard(t)
+
+	tests := []struct {
+		name   string
+		export func() ([]byte, error)
+	}{
+		{"json", satscard.ExportAttestation},
+		{"cbor", satscard.ExportAttestationCBOR},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			bundle, err := test.export()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			attestation, err := ParseAttestation(bundle)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if attestation.Address != card.slotAddress(0) || attestation.Slot != 0 || len(attestation.CertificateChain) != 2 {
+				t.Errorf("attestation of slot %d with address %s and %d certificates", attestation.Slot, attestation.Address, len(attestation.CertificateChain))
+			}
+
+			report, err := VerifyAttestation(bundle, card.trustStore())
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !report.Genuine || report.FactoryRoot != testRoot || !report.ReadSignatureValid || !report.SlotPublicKeyCovered {
+				t.Errorf("report = %+v", *report)
+			}
+
+		})
+	}
+
+}
+
+func TestAttestationNotChecked(t *testing.T) {
+
+	var satscard Satscard
+
+	if _, err := satscard.ExportAttestation(); err == nil {
+		t.Error("attestation exported for a card that was not checked")
+	}
+
+}
+
+func TestVerifyAttestationRejects(t *testing.T) {
+
+	card, satscard := verifiedCard(t)
+
+	bundle, err := satscard.ExportAttestation()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherPublicKey := seededKey("other").PubKey().SerializeCompressed()
+
+	tests := []struct {
+		name   string
+		tamper func(attestation *Attestation)
+	}{
+		{"check signature", func(attestation *Attestation) { attestation.CheckSignature[5] ^= 1 }},
+		{"check nonce", func(attestation *Attestation) { attestation.CheckAppNonce[0] ^= 1 }},
+		{"read signature", func(attestation *Attestation) { attestation.ReadSignature[5] ^= 1 }},
+		{"read nonce", func(attestation *Attestation) { attestation.ReadCardNonce[0] ^= 1 }},
+		{"slot", func(attestation *Attestation) { attestation.Slot = 1 }},
+		{"slot public key", func(attestation *Attestation) { attestation.SlotPublicKey = otherPublicKey }},
+		{"address", func(attestation *Attestation) { attestation.Address = testAddress(t, "other", P2WPKH) }},
+		{"certificate", func(attestation *Attestation) { attestation.CertificateChain[1][64] ^= 1 }},
+		{"missing certificate", func(attestation *Attestation) { attestation.CertificateChain = attestation.CertificateChain[:1] }},
+		{"card public key", func(attestation *Attestation) { attestation.CardPublicKey = otherPublicKey }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			attestation, err := ParseAttestation(bundle)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			test.tamper(attestation)
+
+			tampered, err := json.Marshal(attestation)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := VerifyAttestation(tampered, card.trustStore())
+
+			if !errors.Is(err, ErrInvalidAttestation) {
+				t.Fatalf("err = %v, want %v", err, ErrInvalidAttestation)
+			}
+
+			if report == nil {
+				t.Error("no report for a failed check")
+			}
+
+		})
+	}
+
+}
+
+func TestVerifyAttestationUntrustedRoot(t *testing.T) {
+
+	_, satscard := verifiedCard(t)
+
+	bundle, err := satscard.ExportAttestationCBOR()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The default trust store does not trust the root of the simulated card
+	report, err := VerifyAttestation(bundle, nil)
+
+	if !errors.Is(err, ErrInvalidAttestation) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidAttestation)
+	}
+
+	if report.Genuine || report.FactoryRoot != "" || !report.CheckSignatureValid {
+		t.Errorf("report = %+v", *report)
+	}
+
+}
+
+func TestVerifyAttestationTimestampNotChecked(t *testing.T) {
+
+	card, satscard := verifiedCard(t)
+
+	bundle, err := satscard.ExportAttestation()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attestation, err := ParseAttestation(bundle)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attestation.Timestamp = 0
+
+	if bundle, err = json.Marshal(attestation); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyAttestation(bundle, card.trustStore()); err != nil {
+		t.Errorf("attestation with another timestamp rejected: %v", err)
+	}
+
+}
+
+func TestParseAttestationRejects(t *testing.T) {
+
+	_, satscard := verifiedCard(t)
+
+	bundle, err := satscard.ExportAttestationCBOR()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attestation, err := ParseAttestation(bundle)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attestation.Version = attestationVersion + 1
+
+	unknownVersion, err := cbor.Marshal(attestation)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attestation.Version = attestationVersion
+	attestation.CheckSignature = attestation.CheckSignature[:63]
+
+	shortSignature, err := json.Marshal(attestation)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		bundle []byte
+	}{
+		{"unknown version", unknownVersion},
+		{"short signature", shortSignature},
+		{"truncated", bundle[:len(bundle)/2]},
+		{"empty", nil},
+	}
+
+	for _, test := range tests {
+		if report, err := VerifyAttestation(test.bundle, nil); err == nil || report != nil {
+			t.Errorf("%s: report %v, err %v", test.name, report, err)
+		}
+	}
+
+}
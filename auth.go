@@ -14,6 +14,11 @@ func (satscard *Satscard) authenticate(cvc string, command command) (*auth, erro
 	slog.Debug("AUTH", "CVC", cvc)
 	slog.Debug("AUTH", "Command", command.Cmd)
 
+	if satscard.Strict && !satscard.verified {
+		satscard.cvc = ""
+		return nil, ErrCardNotVerified
+	}
+
 	cardPublicKey, err := btcec.ParsePubKey(satscard.cardPublicKey[:])
 	if err != nil {
 		return nil, err
@@ -22,7 +27,7 @@ func (satscard *Satscard) authenticate(cvc string, command command) (*auth, erro
 	// Derive an ephemeral public/private keypair for performing ECDHE with
 	// the recipient.
 
-	ephemeralPrivateKey, err := secp256k1.GeneratePrivateKey()
+	ephemeralPrivateKey, err := secp256k1.GeneratePrivateKeyFromRand(satscard.random())
 	if err != nil {
 		return nil, err
 	}
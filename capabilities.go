@@ -0,0 +1,174 @@
+package tapcards
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// latestKnownProto is the newest protocol version this library knows about.
+const latestKnownProto = 1
+
+// Capabilities describes what a firmware generation of the card supports.
+type Capabilities struct {
+	// Commands holds the commands supported by the firmware.
+	Commands map[string]bool
+	// ChainCodeOnNew reports whether new accepts a chain code from the app as its entropy share.
+	ChainCodeOnNew bool
+}
+
+// Supports reports whether the firmware supports the command.
+func (capabilities *Capabilities) Supports(command string) bool {
+	return capabilities.Commands[command]
+}
+
+// firmwareGeneration is a row of the capability matrix, covering the firmware versions of a
+// protocol version from minVersion up to the next row.
+type firmwareGeneration struct {
+	proto        int
+	minVersion   string
+	capabilities Capabilities
+}
+
+// capabilityMatrix records what each firmware generation supports, in ascending order, following the
+// changelog of the protocol. The first SATSCARD firmware already has dump, while nfc and the chain code
+// argument of new came with 1.0.0.
+var capabilityMatrix = []firmwareGeneration{
+	{
+		proto:      1,
+		minVersion: "0.9.0",
+		capabilities: Capabilities{
+			Commands: commandSet("status", "read", "certs", "check", "new", "unseal", "wait", "dump"),
+		},
+	},
+	{
+		proto:      1,
+		minVersion: "1.0.0",
+		capabilities: Capabilities{
+			Commands:       commandSet("status", "read", "certs", "check", "new", "unseal", "wait", "dump", "nfc"),
+			ChainCodeOnNew: true,
+		},
+	},
+}
+
+func commandSet(commands ...string) map[string]bool {
+
+	set := make(map[string]bool, len(commands))
+
+	for _, command := range commands {
+		set[command] = true
+	}
+
+	return set
+
+}
+
+// CapabilitiesFor returns the capabilities of the firmware with the given protocol version and firmware
+// version. A card with a newer protocol version than this library knows is assumed to support what the
+// newest known generation does, and the second return value reports whether that was the case.
+func CapabilitiesFor(proto int, version string) (*Capabilities, bool) {
+
+	var match *firmwareGeneration
+
+	for i := range capabilityMatrix {
+
+		generation := &capabilityMatrix[i]
+
+		if generation.proto > proto {
+			break
+		}
+
+		// The oldest generation of a protocol covers any older firmware as well
+		if match == nil || generation.proto < proto || compareVersions(version, generation.minVersion) >= 0 {
+			match = generation
+		}
+
+	}
+
+	if match == nil {
+		match = &capabilityMatrix[0]
+	}
+
+	return &match.capabilities, proto > latestKnownProto
+
+}
+
+// Capabilities returns the capabilities of the card, or nil until status has been parsed.
+func (satscard *Satscard) Capabilities() *Capabilities {
+
+	if satscard.Proto == 0 && satscard.Version == "" {
+		return nil
+	}
+
+	capabilities, _ := CapabilitiesFor(satscard.Proto, satscard.Version)
+
+	return capabilities
+
+}
+
+// requireCapability fails with an UnsupportedCommandError if the card is known not to support the command.
+func (satscard *Satscard) requireCapability(command string) error {
+
+	capabilities := satscard.Capabilities()
+
+	if capabilities == nil || capabilities.Supports(command) {
+		return nil
+	}
+
+	return &UnsupportedCommandError{Command: command, Proto: satscard.Proto, Version: satscard.Version}
+
+}
+
+// warnNewerProto logs a warning when the card reports a newer protocol version than this library knows.
+func warnNewerProto(proto int, version string) {
+
+	if _, newer := CapabilitiesFor(proto, version); newer {
+		slog.Warn("Card firmware is newer than this library knows about", "Proto", proto, "Version", version, "LatestKnownProto", latestKnownProto)
+	}
+
+}
+
+// compareVersions compares two dotted firmware versions such as 1.0.3, returning -1, 0 or 1.
+// Any suffix after the digits of a component is ignored.
+func compareVersions(a string, b string) int {
+
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+
+		x := versionComponent(as, i)
+		y := versionComponent(bs, i)
+
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+
+	}
+
+	return 0
+
+}
+
+func versionComponent(components []string, i int) int {
+
+	if i >= len(components) {
+		return 0
+	}
+
+	digits := strings.TrimSpace(components[i])
+
+	end := strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' })
+
+	if end >= 0 {
+		digits = digits[:end]
+	}
+
+	n, _ := strconv.Atoi(digits)
+
+	return n
+
+}
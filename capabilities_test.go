@@ -0,0 +1,99 @@
+package tapcards
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.0", "1.0.0", 0},
+		{"0.9.0", "1.0.0", -1},
+		{"1.0.3", "1.0.0", 1},
+		{"1.0.10", "1.0.9", 1},
+		{"0.9.9", "0.10.0", -1},
+		{"1.0.3X", "1.0.3", 0},
+		{"1.0.3rc1", "1.0.4", -1},
+		{" 1.0.0 ", "1.0.0", 0},
+		{"", "0.0.0", 0},
+		{"2", "1.9.9", 1},
+	}
+
+	for _, test := range tests {
+		if got := compareVersions(test.a, test.b); got != test.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+
+}
+
+func TestCapabilitiesFor(t *testing.T) {
+
+	tests := []struct {
+		proto          int
+		version        string
+		dump           bool
+		nfc            bool
+		chainCodeOnNew bool
+		newer          bool
+	}{
+		{1, "0.8.0", true, false, false, false},
+		{1, "0.9.0", true, false, false, false},
+		{1, "0.9.12", true, false, false, false},
+		{1, "1.0.0", true, true, true, false},
+		{1, "1.0.3", true, true, true, false},
+		{0, "1.0.3", true, false, false, false},
+		{2, "0.1.0", true, true, true, true},
+	}
+
+	for _, test := range tests {
+
+		capabilities, newer := CapabilitiesFor(test.proto, test.version)
+
+		if got := capabilities.Supports("dump"); got != test.dump {
+			t.Errorf("CapabilitiesFor(%d, %q) supports dump = %v, want %v", test.proto, test.version, got, test.dump)
+		}
+
+		if got := capabilities.Supports("nfc"); got != test.nfc {
+			t.Errorf("CapabilitiesFor(%d, %q) supports nfc = %v, want %v", test.proto, test.version, got, test.nfc)
+		}
+
+		if capabilities.ChainCodeOnNew != test.chainCodeOnNew {
+			t.Errorf("CapabilitiesFor(%d, %q) chain code on new = %v, want %v", test.proto, test.version, capabilities.ChainCodeOnNew, test.chainCodeOnNew)
+		}
+
+		if newer != test.newer {
+			t.Errorf("CapabilitiesFor(%d, %q) newer = %v, want %v", test.proto, test.version, newer, test.newer)
+		}
+
+	}
+
+}
+
+func TestRequireCapability(t *testing.T) {
+
+	satscard := Satscard{Proto: 1, Version: "0.9.0"}
+
+	var unsupported *UnsupportedCommandError
+
+	if err := satscard.requireCapability("nfc"); !errors.As(err, &unsupported) || unsupported.Command != "nfc" {
+		t.Errorf("requireCapability(nfc) = %v, want an UnsupportedCommandError", err)
+	}
+
+	if err := satscard.requireCapability("dump"); err != nil {
+		t.Errorf("requireCapability(dump) = %v, want nil", err)
+	}
+
+	satscard.Version = "1.0.0"
+
+	if err := satscard.requireCapability("nfc"); err != nil {
+		t.Errorf("requireCapability(nfc) = %v, want nil", err)
+	}
+
+}
@@ -9,18 +9,43 @@ func (satscard *Satscard) CertsRequest() ([]byte, error) {
 	// Log the request for debugging purposes
 	slog.Debug("Request certs")
 
+	satscard.startPipeline()
+
 	// If the current card nonce is zero, enqueue a status command
 	if satscard.currentCardNonce == [16]byte{} {
 		satscard.queue.enqueue("status")
 	}
 
 	// Enqueue the commands
+	satscard.enqueueVerification()
+
+	// Return the next command to be sent to the card
+	return satscard.nextCommand()
+}
+
+// enqueueVerification enqueues the commands that verify the card's certificate chain.
+// The read is skipped once certs has been parsed if the active slot turns out not to be sealed.
+func (satscard *Satscard) enqueueVerification() {
+
 	satscard.queue.enqueue("certs")
 	satscard.queue.enqueue("read")
 	satscard.queue.enqueue("check")
 
-	// Return the next command to be sent to the card
-	return satscard.nextCommand()
+}
+
+// enqueueAuthenticated enqueues a command sending the CVC. In strict mode, the commands verifying the
+// card are queued ahead of it unless the card has been verified already, so the CVC never reaches a
+// card that is not genuine.
+func (satscard *Satscard) enqueueAuthenticated(command string, cvc string) {
+
+	if cvc != "" && satscard.Strict && !satscard.verified {
+		satscard.enqueueVerification()
+	}
+
+	satscard.queue.enqueue(command)
+
+	satscard.cvc = cvc
+
 }
 
 // certsRequest is a method of the Satscard struct. It creates a certs command and wraps it into an APDU command.
@@ -47,6 +72,18 @@ func (satscard *Satscard) parseCertsData(certsData certsData) error {
 	// Assign the CertificateChain field of the certsData to the certificateChain field of the Satscard
 	satscard.certificateChain = certsData.CertificateChain
 
+	// An unused or unsealed slot has no public key to read, so check verifies the chain without it
+	if state := satscard.ActiveSlotState(); state == SlotUnused || state == SlotUnsealed {
+
+		if satscard.queue.peek() == "read" {
+
+			slog.Debug("Skip read", "Slot", satscard.ActiveSlot, "State", state)
+
+			satscard.queue.dequeue()
+		}
+
+	}
+
 	// Return nil as there is no error
 	return nil
 }
@@ -0,0 +1,42 @@
+package tapcards
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnqueueAuthenticated(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		strict   bool
+		verified bool
+		request  func(satscard *Satscard) ([]byte, error)
+		want     []interface{}
+	}{
+		{"unseal", true, false, func(satscard *Satscard) ([]byte, error) { return satscard.UnsealRequest("123456") }, []interface{}{"status", "certs", "read", "check", "unseal"}},
+		{"unseal verified", true, true, func(satscard *Satscard) ([]byte, error) { return satscard.UnsealRequest("123456") }, []interface{}{"status", "unseal"}},
+		{"unseal not strict", false, false, func(satscard *Satscard) ([]byte, error) { return satscard.UnsealRequest("123456") }, []interface{}{"status", "unseal"}},
+		{"new", true, false, func(satscard *Satscard) ([]byte, error) { return satscard.NewRequest("123456") }, []interface{}{"status", "certs", "read", "check", "new"}},
+		{"dump", true, false, func(satscard *Satscard) ([]byte, error) { return satscard.DumpRequest(0, "123456") }, []interface{}{"status", "certs", "read", "check", "dump"}},
+		{"dump without cvc", true, false, func(satscard *Satscard) ([]byte, error) { return satscard.DumpRequest(0, "") }, []interface{}{"status", "dump"}},
+		{"recover", true, false, func(satscard *Satscard) ([]byte, error) { return satscard.RecoverRequest("123456") }, []interface{}{"status", "certs", "read", "check", "recover"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			satscard := Satscard{Strict: test.strict, verified: test.verified}
+
+			if _, err := test.request(&satscard); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(satscard.queue.elements, test.want) {
+				t.Errorf("queue = %v, want %v", satscard.queue.elements, test.want)
+			}
+
+		})
+	}
+
+}
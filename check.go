@@ -1,15 +1,11 @@
 package tapcards
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
 	"log/slog"
 
 	"github.com/btcsuite/btcd/btcec/v2"
-	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
 )
 
 func (satscard *Satscard) checkRequest() ([]byte, error) {
@@ -36,23 +32,15 @@ func (satscard *Satscard) parseCheckData(checkData checkData) error {
 	slog.Debug("CHECK", "AuthSignature", fmt.Sprintf("%x", checkData.AuthSignature[:]))
 	slog.Debug("CHECK", "CardNonce", fmt.Sprintf("%x", checkData.CardNonce[:]))
 
-	message := append([]byte(openDime), satscard.currentCardNonce[:]...)
-	message = append(message, satscard.appNonce[:]...)
-
-	if satscard.activeSlotPublicKey != [33]byte{} {
-		slog.Debug("Adding current slot public key")
-		message = append(message, satscard.activeSlotPublicKey[:]...)
+	if err := satscard.rememberCardNonce(checkData.CardNonce); err != nil {
+		return err
 	}
 
-	messageDigest := sha256.Sum256([]byte(message))
-
-	r := new(btcec.ModNScalar)
-	r.SetByteSlice(checkData.AuthSignature[0:32])
-
-	s := new(btcec.ModNScalar)
-	s.SetByteSlice(checkData.AuthSignature[32:64])
-
-	signature := ecdsa.NewSignature(r, s)
+	satscard.checkChallenge = &signedChallenge{
+		cardNonce: satscard.currentCardNonce,
+		appNonce:  satscard.appNonce,
+		signature: checkData.AuthSignature,
+	}
 
 	publicKey, err := btcec.ParsePubKey(satscard.cardPublicKey[:])
 
@@ -60,43 +48,60 @@ func (satscard *Satscard) parseCheckData(checkData checkData) error {
 		return err
 	}
 
-	verified := signature.Verify(messageDigest[:], publicKey)
+	var slotPublicKey []byte
 
-	if !verified {
-		return errors.New("invalid signature certs")
+	if satscard.activeSlotPublicKey != [33]byte{} {
+		slotPublicKey = satscard.activeSlotPublicKey[:]
 	}
 
-	for i := 0; i < len(satscard.certificateChain); i++ {
+	verified, covered := verifyCheckSignature(publicKey, slotPublicKey, *satscard.checkChallenge)
 
-		publicKey, err = signatureToPublicKey(satscard.certificateChain[i], publicKey)
+	if !verified {
 
-		if err != nil {
-			return err
-		}
+		err := errors.New("invalid signature certs")
 
-	}
+		satscard.emit(Event{Type: EventVerificationFailed, Command: "check", Err: err})
 
-	// Convert hex string to bytes
-	factoryRootPublicKeyBytes, err := hex.DecodeString(factoryRootPublicKeyString)
-	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	factoryRootPublicKey, err := btcec.ParsePubKey(factoryRootPublicKeyBytes)
+	slog.Debug("CHECK", "SlotPublicKeyCovered", covered)
+
+	publicKeys, err := certificateChainPublicKeys(publicKey, satscard.certificateChain)
 
 	if err != nil {
 		return err
 	}
 
-	if !factoryRootPublicKey.IsEqual(publicKey) {
+	publicKey = publicKeys[len(publicKeys)-1]
+
+	factoryRoot, trusted := satscard.trustStore().match(publicKey)
+
+	if len(satscard.certificateChain) == 0 || !trusted {
 
-		slog.Debug("CHECK", "FactoryRootPublicKey", fmt.Sprintf("%x", factoryRootPublicKey.SerializeCompressed()))
 		slog.Debug("CHECK", "PublicKey", fmt.Sprintf("%x", publicKey.SerializeCompressed()))
 
-		return errors.New("counterfeit card: invalid factory root public key")
+		satscard.emit(Event{Type: EventVerificationFailed, Command: "check", Err: ErrUntrustedFactoryRoot})
+
+		return ErrUntrustedFactoryRoot
 
 	}
 
+	slog.Debug("CHECK", "FactoryRoot", factoryRoot)
+
+	if err := satscard.checkRegistry(factoryRoot); err != nil {
+
+		satscard.emit(Event{Type: EventVerificationFailed, Command: "check", Err: err})
+
+		return err
+
+	}
+
+	satscard.FactoryRoot = factoryRoot
+	satscard.verified = true
+
+	satscard.emit(Event{Type: EventVerificationPassed, Command: "check", FactoryRoot: factoryRoot})
+
 	satscard.currentCardNonce = checkData.CardNonce
 
 	return nil
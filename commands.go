@@ -24,9 +24,8 @@ type unsealCommand struct {
 type newCommand struct {
 	command
 	auth
-	Slot int `cbor:"slot"` // (optional: default zero) slot to be affected, must equal currently-active slot number
-	//ChainCode [32]byte `cbor:"chain_code"` // app's entropy share to be applied to new slot (optional on SATSCARD)
-
+	Slot      int    `cbor:"slot"`                 // (optional: default zero) slot to be affected, must equal currently-active slot number
+	ChainCode []byte `cbor:"chain_code,omitempty"` // app's entropy share to be applied to new slot (optional on SATSCARD)
 }
 
 type readCommand struct {
@@ -46,3 +45,10 @@ type checkCommand struct {
 type waitCommand struct {
 	command
 }
+
+type dumpCommand struct {
+	command
+	Slot            int    `cbor:"slot"`              // slot to be dumped
+	EphemeralPubKey []byte `cbor:"epubkey,omitempty"` // app's ephemeral public key, only to reveal the private key
+	XCVC            []byte `cbor:"xcvc,omitempty"`    // encrypted CVC value, only to reveal the private key
+}
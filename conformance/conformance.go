@@ -0,0 +1,372 @@
+// Package conformance is a test suite exercising a SATSCARD over any tapcards.Transport, so the same
+// test code runs against emulators and real cards.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/schjonhaug/tapcards"
+)
+
+// wrongCVC is sent to exercise the wrong CVC path. It is changed if it happens to be the right one.
+const wrongCVC = "000000"
+
+// maxWrongCVCs is the number of wrong CVCs after which the card must have imposed an authentication delay.
+const maxWrongCVCs = 10
+
+// timeout limits each operation, which leaves room for waiting out the authentication delay.
+const timeout = 2 * time.Minute
+
+// Run exercises status, read, certs and check, wait, a wrong CVC, the authentication delay, unseal and new
+// against the card behind the transport, checking invariants such as the consistency of addresses and
+// public keys, and the rotation of the card nonce. Wrong CVCs are sent until the card imposes an
+// authentication delay, which is then waited out.
+//
+// Run is destructive: it unseals the active slot if it is sealed, and sets up the next slot if there is
+// one. Use emulators or sacrificial cards only. The card is verified against the default trust store,
+// which only trusts the emulator root in builds with the tapcards_emulator tag.
+func Run(t *testing.T, transport tapcards.Transport, cvc string) {
+
+	satscard := tapcards.NewSatscard()
+
+	session := tapcards.NewSession(satscard, transport)
+	session.Timeout = timeout
+
+	ctx := context.Background()
+
+	steps := []struct {
+		name string
+		run  func(t *testing.T, session *tapcards.Session, cvc string)
+	}{
+		{"Status", testStatus},
+		{"Read", testRead},
+		{"Certs", testCerts},
+		{"Wait", testWait},
+		{"WrongCVC", testWrongCVC},
+		{"AuthDelay", testAuthDelay},
+		{"Unseal", testUnseal},
+		{"New", testNew},
+	}
+
+	for _, step := range steps {
+
+		ok := t.Run(step.name, func(t *testing.T) {
+
+			// Every step starts from a freshly selected applet
+			if _, err := session.Select(ctx); err != nil {
+				t.Fatalf("select: %v", err)
+			}
+
+			step.run(t, session, cvc)
+
+		})
+
+		// Later steps build on the earlier ones
+		if !ok {
+			return
+		}
+
+	}
+
+}
+
+func testStatus(t *testing.T, session *tapcards.Session, cvc string) {
+
+	satscard := session.Satscard
+
+	// A replayed card nonce fails the command, so repeated status commands prove the nonce rotates
+	for i := 0; i < 3; i++ {
+		if _, err := session.Status(context.Background()); err != nil {
+			t.Fatalf("status %d: %v", i+1, err)
+		}
+	}
+
+	if satscard.Identity == "" {
+		t.Error("empty identity")
+	}
+
+	if satscard.Proto == 0 {
+		t.Error("protocol version not reported")
+	}
+
+	if satscard.NumberOfSlots <= 0 {
+		t.Errorf("invalid number of slots: %d", satscard.NumberOfSlots)
+	}
+
+	if satscard.ActiveSlot < 0 || satscard.ActiveSlot >= satscard.NumberOfSlots {
+		t.Errorf("active slot %d out of range for %d slots", satscard.ActiveSlot, satscard.NumberOfSlots)
+	}
+
+	if satscard.AuthDelay < 0 {
+		t.Errorf("negative auth delay: %d", satscard.AuthDelay)
+	}
+
+	if state := satscard.ActiveSlotState(); state != tapcards.SlotSealed && state != tapcards.SlotUnsealed {
+		t.Errorf("active slot is %v", state)
+	}
+
+	if satscard.ActiveSlotState() == tapcards.SlotSealed && satscard.ActiveSlotTruncatedPaymentAddress == "" {
+		t.Error("sealed slot without an address")
+	}
+
+}
+
+func testRead(t *testing.T, session *tapcards.Session, cvc string) {
+
+	satscard := session.Satscard
+
+	if satscard.ActiveSlotState() != tapcards.SlotSealed {
+		t.Skipf("active slot is %v", satscard.ActiveSlotState())
+	}
+
+	if _, err := session.Read(context.Background()); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	checkAddress(t, satscard.ActiveSlotPaymentAddress, satscard.ActiveSlotTruncatedPaymentAddress)
+
+}
+
+func testCerts(t *testing.T, session *tapcards.Session, cvc string) {
+
+	satscard := session.Satscard
+
+	if _, err := session.Certs(context.Background()); err != nil {
+		t.Fatalf("certs: %v", err)
+	}
+
+	if satscard.FactoryRoot == "" {
+		t.Error("no factory root after verification")
+	}
+
+	report, err := satscard.Verify()
+
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	if !report.Genuine {
+		t.Errorf("card not genuine: %+v", report)
+	}
+
+	if !report.CheckSignatureValid || !report.ReadSignatureValid {
+		t.Errorf("invalid signatures: check %v, read %v", report.CheckSignatureValid, report.ReadSignatureValid)
+	}
+
+}
+
+func testWait(t *testing.T, session *tapcards.Session, cvc string) {
+
+	satscard := session.Satscard
+
+	before := satscard.AuthDelay
+
+	if _, err := session.Wait(context.Background()); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+
+	if satscard.AuthDelay < 0 || (before > 0 && satscard.AuthDelay >= before) {
+		t.Errorf("auth delay went from %d to %d", before, satscard.AuthDelay)
+	}
+
+}
+
+func testWrongCVC(t *testing.T, session *tapcards.Session, cvc string) {
+
+	satscard := session.Satscard
+
+	wrong := wrongCVC
+
+	if wrong == cvc {
+		wrong = "111111"
+	}
+
+	if _, err := session.WaitForAuthDelay(context.Background()); err != nil {
+		t.Fatalf("wait for auth delay: %v", err)
+	}
+
+	activeSlot := satscard.ActiveSlot
+
+	var authenticate func(cvc string) error
+
+	switch {
+	case satscard.ActiveSlotState() == tapcards.SlotSealed:
+		authenticate = func(cvc string) error {
+			_, err := session.Unseal(context.Background(), cvc)
+			return err
+		}
+	case satscard.ActiveSlot+1 < satscard.NumberOfSlots:
+		authenticate = func(cvc string) error {
+			_, err := session.New(context.Background(), cvc)
+			return err
+		}
+	default:
+		t.Skip("no command left to authenticate")
+	}
+
+	// The card imposes an authentication delay after a few wrong CVCs
+	for attempt := 1; satscard.AuthDelay == 0; attempt++ {
+
+		if attempt > maxWrongCVCs {
+			t.Fatalf("no auth delay after %d wrong CVCs", maxWrongCVCs)
+		}
+
+		err := authenticate(wrong)
+
+		var cardError *tapcards.CardError
+
+		if !errors.As(err, &cardError) {
+			t.Fatalf("attempt %d: expected the card to refuse the wrong CVC, got %v", attempt, err)
+		}
+
+		if cardError.Code != 401 && cardError.Code != 429 {
+			t.Fatalf("attempt %d: unexpected error code: %v", attempt, cardError)
+		}
+
+		if _, err := session.Status(context.Background()); err != nil {
+			t.Fatalf("status: %v", err)
+		}
+
+		if satscard.ActiveSlot != activeSlot {
+			t.Fatalf("active slot changed from %d to %d with a wrong CVC", activeSlot, satscard.ActiveSlot)
+		}
+
+	}
+
+}
+
+func testAuthDelay(t *testing.T, session *tapcards.Session, cvc string) {
+
+	satscard := session.Satscard
+
+	if _, err := session.Status(context.Background()); err != nil {
+		t.Fatalf("status: %v", err)
+	}
+
+	if satscard.AuthDelay <= 0 {
+		t.Fatalf("auth delay is %d after the wrong CVCs", satscard.AuthDelay)
+	}
+
+	if _, err := session.WaitForAuthDelay(context.Background()); err != nil {
+		t.Fatalf("wait for auth delay: %v", err)
+	}
+
+	if satscard.AuthDelay != 0 {
+		t.Fatalf("auth delay still %d", satscard.AuthDelay)
+	}
+
+	// The card reports the delay as over
+	if _, err := session.Status(context.Background()); err != nil {
+		t.Fatalf("status: %v", err)
+	}
+
+	if satscard.AuthDelay != 0 {
+		t.Errorf("status reports an auth delay of %d after waiting", satscard.AuthDelay)
+	}
+
+}
+
+func testUnseal(t *testing.T, session *tapcards.Session, cvc string) {
+
+	satscard := session.Satscard
+
+	if satscard.ActiveSlotState() != tapcards.SlotSealed {
+		t.Skipf("active slot is %v", satscard.ActiveSlotState())
+	}
+
+	truncated := satscard.ActiveSlotTruncatedPaymentAddress
+
+	if _, err := session.Unseal(context.Background(), cvc); err != nil {
+		t.Fatalf("unseal: %v", err)
+	}
+
+	if state := satscard.ActiveSlotState(); state != tapcards.SlotUnsealed {
+		t.Errorf("active slot is %v after unseal", state)
+	}
+
+	wif, err := btcutil.DecodeWIF(satscard.ActiveSlotPrivateKey)
+
+	if err != nil {
+		t.Fatalf("private key: %v", err)
+	}
+
+	address, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(wif.SerializePubKey()), &chaincfg.MainNetParams)
+
+	if err != nil {
+		t.Fatalf("address: %v", err)
+	}
+
+	checkAddress(t, address.EncodeAddress(), truncated)
+
+	if satscard.ActiveSlotPaymentAddress != "" && satscard.ActiveSlotPaymentAddress != address.EncodeAddress() {
+		t.Errorf("private key derives %s, read returned %s", address.EncodeAddress(), satscard.ActiveSlotPaymentAddress)
+	}
+
+}
+
+func testNew(t *testing.T, session *tapcards.Session, cvc string) {
+
+	satscard := session.Satscard
+
+	if satscard.ActiveSlotState() != tapcards.SlotUnsealed {
+		t.Skipf("active slot is %v", satscard.ActiveSlotState())
+	}
+
+	if satscard.ActiveSlot+1 >= satscard.NumberOfSlots {
+		t.Skip("no more slots available")
+	}
+
+	activeSlot := satscard.ActiveSlot
+
+	if _, err := session.New(context.Background(), cvc); err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	if satscard.ActiveSlot != activeSlot+1 {
+		t.Fatalf("active slot is %d after new, expected %d", satscard.ActiveSlot, activeSlot+1)
+	}
+
+	if _, err := session.Status(context.Background()); err != nil {
+		t.Fatalf("status: %v", err)
+	}
+
+	if state := satscard.ActiveSlotState(); state != tapcards.SlotSealed {
+		t.Errorf("new slot is %v", state)
+	}
+
+	if _, err := session.Read(context.Background()); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	checkAddress(t, satscard.ActiveSlotPaymentAddress, satscard.ActiveSlotTruncatedPaymentAddress)
+
+}
+
+// checkAddress checks that a full address matches the truncated address reported by status.
+func checkAddress(t *testing.T, address string, truncated string) {
+
+	t.Helper()
+
+	if address == "" {
+		t.Error("no address")
+		return
+	}
+
+	if truncated == "" {
+		return
+	}
+
+	prefix, _, _ := strings.Cut(truncated, "_")
+	suffix := truncated[strings.LastIndex(truncated, "_")+1:]
+
+	if !strings.HasPrefix(address, prefix) || !strings.HasSuffix(address, suffix) {
+		t.Errorf("address %s does not match %s", address, truncated)
+	}
+
+}
@@ -0,0 +1,93 @@
+//go:build tapcards_emulator
+
+package conformance_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/schjonhaug/tapcards/conformance"
+	"github.com/skythen/apdu"
+)
+
+// emulatorTransport exchanges the CBOR payloads of the command APDUs with the Python emulator over its
+// Unix socket. The emulator has no applet select, so select is answered with the status it would return.
+type emulatorTransport struct {
+	mutex      sync.Mutex
+	connection net.Conn
+}
+
+func (transport *emulatorTransport) Transmit(ctx context.Context, command []byte) ([]byte, error) {
+
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	capdu, err := apdu.ParseCapdu(command)
+
+	if err != nil {
+		return nil, err
+	}
+
+	request := capdu.Data
+
+	if capdu.Ins == 0xA4 {
+
+		request, err = cbor.Marshal(map[string]string{"cmd": "status"})
+
+		if err != nil {
+			return nil, err
+		}
+
+	}
+
+	deadline, _ := ctx.Deadline()
+
+	if err := transport.connection.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if _, err := transport.connection.Write(request); err != nil {
+		return nil, err
+	}
+
+	buffer := make([]byte, 4096)
+
+	n, err := transport.connection.Read(buffer)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rapdu := apdu.Rapdu{Data: buffer[:n], SW1: 0x90, SW2: 0x00}
+
+	return rapdu.Bytes()
+
+}
+
+// TestEmulator runs the suite against the Python emulator listening on the Unix socket named by
+// TAPCARDS_EMULATOR, such as /tmp/ecard-pipe. It is skipped when the variable is not set. The build tag
+// makes the default trust store trust the emulator root.
+func TestEmulator(t *testing.T) {
+
+	path := os.Getenv("TAPCARDS_EMULATOR")
+
+	if path == "" {
+		t.Skip("TAPCARDS_EMULATOR not set")
+	}
+
+	connection, err := net.DialTimeout("unix", path, 5*time.Second)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer connection.Close()
+
+	conformance.Run(t, &emulatorTransport{connection: connection}, "123456")
+
+}
@@ -8,6 +8,7 @@ type cardResponse struct {
 
 type statusData struct {
 	cardResponse
+	extraFields
 	Proto     int
 	Birth     int
 	Slots     []int
@@ -19,40 +20,60 @@ type statusData struct {
 
 type unsealData struct {
 	cardResponse
-	Slot            int      // slot just unsealed
-	PrivateKey      [32]byte `cbor:"privkey"`    // private key for spending
-	PublicKey       [33]byte `cbor:"pubkey"`     // slot's pubkey (convenience, since could be calc'd from privkey)
-	MasterPublicKey [32]byte `cbor:"master_pk"`  // card's master private key
-	ChainCode       [32]byte `cbor:"chain_code"` // nonce provided by customer
+	extraFields
+	Slot             int      // slot just unsealed
+	PrivateKey       [32]byte `cbor:"privkey"`    // private key for spending
+	PublicKey        [33]byte `cbor:"pubkey"`     // slot's pubkey (convenience, since could be calc'd from privkey)
+	MasterPrivateKey [32]byte `cbor:"master_pk"`  // card's master private key
+	ChainCode        [32]byte `cbor:"chain_code"` // nonce provided by customer
 
 }
 
 type newData struct {
 	cardResponse
+	extraFields
 	Slot int
 }
 
 type checkData struct {
 	cardResponse
+	extraFields
 	AuthSignature [64]byte `cbor:"auth_sig"` //  signature using card_pubkey
 }
 
 type readData struct {
 	cardResponse
+	extraFields
 	Signature [64]byte `cbor:"sig"`    //  signature over a bunch of fields using private key of slot
 	PublicKey [33]byte `cbor:"pubkey"` // public key for this slot/derivation
 
 }
 
 type certsData struct {
+	extraFields
 	CertificateChain [][65]byte `cbor:"cert_chain"`
 }
 
 type waitData struct {
+	extraFields
 	Success   bool `cbor:"success"`
 	AuthDelay int  `cbor:"auth_delay"`
 }
 
+type dumpData struct {
+	cardResponse
+	extraFields
+	Slot             int      // slot being dumped
+	PrivateKey       [32]byte `cbor:"privkey"`    // private key for spending, only with CVC
+	PublicKey        [33]byte `cbor:"pubkey"`     // slot's pubkey, only for unsealed slots
+	MasterPrivateKey [32]byte `cbor:"master_pk"`  // master private key for this slot, only with CVC
+	ChainCode        [32]byte `cbor:"chain_code"` // chain code used in derivation, only with CVC
+	Address          string   `cbor:"addr"`       // full payment address, only for unsealed slots
+	Sealed           bool     `cbor:"sealed"`     // present and true if the slot is sealed
+	Used             *bool    `cbor:"used"`       // present and false if the slot is unused
+	Tampered         bool     `cbor:"tampered"`   // slot was unsealed for unusual reasons
+}
+
 type errorData struct {
 	Code  int
 	Error string
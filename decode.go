@@ -0,0 +1,189 @@
+package tapcards
+
+import (
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+var (
+	// tolerantDecMode ignores fields the library does not know about, so newer firmware keeps working.
+	tolerantDecMode, _ = cbor.DecOptions{}.DecMode()
+	// strictDecMode rejects fields the library does not know about.
+	strictDecMode, _ = cbor.DecOptions{ExtraReturnErrors: cbor.ExtraDecErrorUnknownField}.DecMode()
+)
+
+// extraFields captures the fields of a response that the library does not know about.
+type extraFields struct {
+	Extra map[string]interface{} `cbor:"-"`
+}
+
+func (extraFields *extraFields) setExtra(extra map[string]interface{}) {
+	extraFields.Extra = extra
+}
+
+// response is a pointer to one of the response data types.
+type response[T any] interface {
+	*T
+	setExtra(map[string]interface{})
+}
+
+// parseResponseData decodes the response to a command and hands it to parseData.
+func parseResponseData[T any, PT response[T]](satscard *Satscard, command string, data []byte, parseData func(T) error) error {
+
+	value, err := decodeResponseData[T, PT](satscard, command, data)
+
+	if err != nil {
+		return err
+	}
+
+	return parseData(value)
+
+}
+
+// decodeResponseData decodes the response to a command. Error responses are returned as a CardError.
+//
+// Fields the library does not know about are rejected when StrictDecoding is set. Otherwise they are
+// reported as protocol drift and kept in the Extra map of the result, and made available through Extra.
+func decodeResponseData[T any, PT response[T]](satscard *Satscard, command string, data []byte) (T, error) {
+
+	var value T
+
+	var fields map[string]interface{}
+
+	if err := tolerantDecMode.Unmarshal(data, &fields); err != nil {
+		return value, err
+	}
+
+	if _, ok := fields["error"]; ok {
+
+		var e errorData
+
+		if err := tolerantDecMode.Unmarshal(data, &e); err != nil {
+			return value, err
+		}
+
+		return value, &CardError{Code: e.Code, Message: e.Error}
+	}
+
+	decMode := tolerantDecMode
+
+	if satscard.StrictDecoding {
+		decMode = strictDecMode
+	}
+
+	if err := decMode.Unmarshal(data, &value); err != nil {
+		return value, err
+	}
+
+	known := knownFields(reflect.TypeOf(value))
+
+	extra := make(map[string]interface{})
+
+	for key, field := range fields {
+		if !known[strings.ToLower(key)] {
+			extra[key] = field
+		}
+	}
+
+	if len(extra) > 0 {
+
+		keys := make([]string, 0, len(extra))
+
+		for key := range extra {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		// A status reports the firmware it comes from, which is not stored on the Satscard until it is parsed
+		var proto interface{} = satscard.Proto
+		var version interface{} = satscard.Version
+
+		if value, ok := fields["proto"]; ok {
+			proto = value
+		}
+
+		if value, ok := fields["ver"]; ok {
+			version = value
+		}
+
+		slog.Warn("Protocol drift: unknown fields in response", "Command", command, "Fields", keys, "Proto", proto, "Version", version)
+
+		PT(&value).setExtra(extra)
+
+	}
+
+	if satscard.extra == nil {
+		satscard.extra = make(map[string]map[string]interface{})
+	}
+
+	satscard.extra[command] = extra
+
+	return value, nil
+
+}
+
+// knownFieldsCache holds the lower case CBOR keys of each response data type.
+var knownFieldsCache sync.Map
+
+// knownFields returns the lower case CBOR keys decoded into the fields of a struct type,
+// including the fields of embedded structs.
+func knownFields(structType reflect.Type) map[string]bool {
+
+	if known, ok := knownFieldsCache.Load(structType); ok {
+		return known.(map[string]bool)
+	}
+
+	known := make(map[string]bool)
+
+	for i := 0; i < structType.NumField(); i++ {
+
+		field := structType.Field(i)
+
+		name, _, _ := strings.Cut(field.Tag.Get("cbor"), ",")
+
+		if name == "-" {
+			continue
+		}
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && name == "" {
+
+			for key := range knownFields(field.Type) {
+				known[key] = true
+			}
+
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		known[strings.ToLower(name)] = true
+
+	}
+
+	knownFieldsCache.Store(structType, known)
+
+	return known
+
+}
+
+// Extra returns the fields of the last response to the given command that the library does not know
+// about, such as fields added by newer firmware. It returns nil if there were none.
+func (satscard *Satscard) Extra(command string) map[string]interface{} {
+
+	extra := satscard.extra[command]
+
+	if len(extra) == 0 {
+		return nil
+	}
+
+	return extra
+
+}
@@ -0,0 +1,94 @@
+package tapcards
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// statusResponse returns the CBOR of a status response from newer firmware, with a field the library
+// does not know about.
+func statusResponse(t *testing.T) []byte {
+
+	data, err := cbor.Marshal(map[string]interface{}{
+		"proto":      2,
+		"ver":        "2.0.0",
+		"birth":      800000,
+		"slots":      []int{0, 10},
+		"addr":       "bc1q…",
+		"pubkey":     seededKey("card").PubKey().SerializeCompressed(),
+		"card_nonce": make([]byte, 16),
+		"tap_nonce":  []byte{1, 2, 3},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+
+}
+
+func TestDecodeUnknownField(t *testing.T) {
+
+	var log bytes.Buffer
+
+	defer slog.SetDefault(slog.Default())
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(&log, nil)))
+
+	// The firmware of the card is not known before its first status
+	satscard := Satscard{Proto: 1, Version: "1.0.3"}
+
+	status, err := decodeResponseData[statusData](&satscard, "status", statusResponse(t))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{"tap_nonce": []byte{1, 2, 3}}
+
+	if !reflect.DeepEqual(status.Extra, want) || !reflect.DeepEqual(satscard.Extra("status"), want) {
+		t.Errorf("extra = %v and %v, want %v", status.Extra, satscard.Extra("status"), want)
+	}
+
+	if status.Proto != 2 || status.Version != "2.0.0" {
+		t.Errorf("known fields decoded as proto %d, version %q", status.Proto, status.Version)
+	}
+
+	// The drift is reported with the firmware of the response, not the one seen before
+	if line := log.String(); !strings.Contains(line, "Fields=[tap_nonce]") || !strings.Contains(line, "Proto=2 Version=2.0.0") {
+		t.Errorf("logged %q", line)
+	}
+
+	// A response without unknown fields leaves nothing behind
+	if _, err := decodeResponseData[waitData](&satscard, "wait", []byte{0xa1, 0x67, 's', 'u', 'c', 'c', 'e', 's', 's', 0xf5}); err != nil {
+		t.Fatal(err)
+	}
+
+	if satscard.Extra("wait") != nil {
+		t.Errorf("extra = %v, want nil", satscard.Extra("wait"))
+	}
+
+}
+
+func TestDecodeStrictUnknownField(t *testing.T) {
+
+	satscard := Satscard{StrictDecoding: true}
+
+	var unknownField *cbor.UnknownFieldError
+
+	if _, err := decodeResponseData[statusData](&satscard, "status", statusResponse(t)); !errors.As(err, &unknownField) {
+		t.Fatalf("err = %v, want an UnknownFieldError", err)
+	}
+
+	if satscard.Extra("status") != nil {
+		t.Error("extra kept for a rejected response")
+	}
+
+}
@@ -0,0 +1,249 @@
+package tapcards
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ImportDescriptor is a request of the importdescriptors RPC of Bitcoin Core.
+type ImportDescriptor struct {
+	// Descriptor is the output descriptor with its checksum.
+	Descriptor string `json:"desc"`
+	// Timestamp is the UNIX time to start rescanning the blockchain from.
+	Timestamp int64 `json:"timestamp"`
+	// Label is the label of the address.
+	Label string `json:"label,omitempty"`
+}
+
+// SlotDescriptor returns the output descriptor of a slot with its checksum, as defined in BIP 380.
+// It is wpkh(<WIF>) for an unsealed slot whose private key is known, and wpkh(<public key>) otherwise.
+// The public key of a sealed slot is known once it has been read.
+func (satscard *Satscard) SlotDescriptor(slot int) (string, error) {
+
+	if slot < 0 || slot >= len(satscard.slots) {
+		return "", fmt.Errorf("no such slot: %d", slot)
+	}
+
+	if s := satscard.slots[slot]; s.state == SlotUnsealed && s.privateKey != "" {
+		return addDescriptorChecksum("wpkh(" + s.privateKey + ")")
+	}
+
+	return satscard.SlotWatchOnlyDescriptor(slot)
+
+}
+
+// SlotWatchOnlyDescriptor returns the output descriptor of a slot with its checksum, as defined in
+// BIP 380, without its private key. It is wpkh(<public key>) even when the private key is known.
+func (satscard *Satscard) SlotWatchOnlyDescriptor(slot int) (string, error) {
+
+	if slot < 0 || slot >= len(satscard.slots) {
+		return "", fmt.Errorf("no such slot: %d", slot)
+	}
+
+	if satscard.slots[slot].publicKey == [33]byte{} {
+		return "", fmt.Errorf("key of slot %d is not known", slot)
+	}
+
+	return addDescriptorChecksum(fmt.Sprintf("wpkh(%x)", satscard.slots[slot].publicKey))
+
+}
+
+// ImportDescriptors returns the watch-only descriptors of every slot whose public key is known, as the
+// JSON argument of the importdescriptors RPC of Bitcoin Core, for a wallet with private keys disabled.
+// The rescan starts from an estimate of when the card was born, which errs on the early side.
+func (satscard *Satscard) ImportDescriptors() ([]byte, error) {
+
+	return satscard.importDescriptors(satscard.SlotWatchOnlyDescriptor)
+
+}
+
+// ImportPrivateDescriptors returns the descriptors of every unsealed slot whose private key is known,
+// as the JSON argument of the importdescriptors RPC of Bitcoin Core, for a wallet with private keys
+// enabled. Such a wallet refuses descriptors without private keys, so sealed slots are left out.
+func (satscard *Satscard) ImportPrivateDescriptors() ([]byte, error) {
+
+	return satscard.importDescriptors(func(slot int) (string, error) {
+
+		if s := satscard.slots[slot]; s.state != SlotUnsealed || s.privateKey == "" {
+			return "", fmt.Errorf("private key of slot %d is not known", slot)
+		}
+
+		return satscard.SlotDescriptor(slot)
+
+	})
+
+}
+
+// importDescriptors returns the descriptors of every slot that slotDescriptor succeeds for, as the JSON
+// argument of the importdescriptors RPC.
+func (satscard *Satscard) importDescriptors(slotDescriptor func(slot int) (string, error)) ([]byte, error) {
+
+	requests := []ImportDescriptor{}
+
+	for slot := range satscard.slots {
+
+		descriptor, err := slotDescriptor(slot)
+
+		if err != nil {
+			continue
+		}
+
+		requests = append(requests, ImportDescriptor{
+			Descriptor: descriptor,
+			Timestamp:  birthTimestamp(satscard.Birth),
+			Label:      fmt.Sprintf("SATSCARD %s slot %d", satscard.Identity, slot),
+		})
+
+	}
+
+	return json.Marshal(requests)
+
+}
+
+// blockTimes are the timestamps of the halving blocks, used to estimate the time of a block height.
+var blockTimes = []struct {
+	height    int
+	timestamp int64
+}{
+	{0, 1231006505},
+	{210000, 1354116278},
+	{420000, 1468082773},
+	{630000, 1589225023},
+	{840000, 1713571767},
+}
+
+// birthMargin is subtracted from the estimated time of the birth block, to make up for blocks
+// being found faster or slower than the estimate.
+const birthMargin = 30 * 24 * 60 * 60
+
+// birthTimestamp estimates the UNIX time of a block height, erring on the early side so no
+// transaction is missed by the rescan. A height of zero means the birth is unknown.
+func birthTimestamp(height int) int64 {
+
+	if height <= 0 {
+		return 0
+	}
+
+	i := len(blockTimes) - 1
+
+	for blockTimes[i].height > height {
+		i--
+	}
+
+	var timestamp int64
+
+	if i == len(blockTimes)-1 {
+
+		// Beyond the last known block, assume the target of ten minutes per block
+		timestamp = blockTimes[i].timestamp + int64(height-blockTimes[i].height)*600
+
+	} else {
+
+		from, to := blockTimes[i], blockTimes[i+1]
+
+		timestamp = from.timestamp + (to.timestamp-from.timestamp)*int64(height-from.height)/int64(to.height-from.height)
+
+	}
+
+	timestamp -= birthMargin
+
+	if timestamp < blockTimes[0].timestamp {
+		return blockTimes[0].timestamp
+	}
+
+	return timestamp
+
+}
+
+const (
+	descriptorInputCharset    = "0123456789()[],'/*abcdefgh@:$%{}IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+	descriptorChecksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+)
+
+// addDescriptorChecksum appends the checksum defined in BIP 380 to a descriptor.
+func addDescriptorChecksum(descriptor string) (string, error) {
+
+	checksum, err := descriptorChecksum(descriptor)
+
+	if err != nil {
+		return "", err
+	}
+
+	return descriptor + "#" + checksum, nil
+
+}
+
+// descriptorChecksum computes the checksum of a descriptor, as defined in BIP 380.
+func descriptorChecksum(descriptor string) (string, error) {
+
+	c := uint64(1)
+	class := 0
+	classCount := 0
+
+	for _, character := range descriptor {
+
+		position := strings.IndexRune(descriptorInputCharset, character)
+
+		if position < 0 {
+			return "", fmt.Errorf("invalid character in descriptor: %q", character)
+		}
+
+		c = descriptorPolymod(c, position&31)
+
+		class = class*3 + position>>5
+		classCount++
+
+		if classCount == 3 {
+			c = descriptorPolymod(c, class)
+			class = 0
+			classCount = 0
+		}
+
+	}
+
+	if classCount > 0 {
+		c = descriptorPolymod(c, class)
+	}
+
+	for i := 0; i < 8; i++ {
+		c = descriptorPolymod(c, 0)
+	}
+
+	c ^= 1
+
+	checksum := make([]byte, 8)
+
+	for i := range checksum {
+		checksum[i] = descriptorChecksumCharset[(c>>(5*(7-i)))&31]
+	}
+
+	return string(checksum), nil
+
+}
+
+func descriptorPolymod(c uint64, value int) uint64 {
+
+	c0 := c >> 35
+
+	c = ((c & 0x7ffffffff) << 5) ^ uint64(value)
+
+	if c0&1 != 0 {
+		c ^= 0xf5dee51989
+	}
+	if c0&2 != 0 {
+		c ^= 0xa9fdca3312
+	}
+	if c0&4 != 0 {
+		c ^= 0x1bab10e32d
+	}
+	if c0&8 != 0 {
+		c ^= 0x3706b1677a
+	}
+	if c0&16 != 0 {
+		c ^= 0x644d626ffd
+	}
+
+	return c
+
+}
@@ -0,0 +1,191 @@
+package tapcards
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDescriptorChecksum(t *testing.T) {
+
+	tests := []struct {
+		descriptor string
+		checksum   string
+	}{
+		// The example of BIP 380
+		{"raw(deadbeef)", "89f8spxm"},
+		{"wpkh([d34db33f/84h/0h/0h]xpub6DJ2dNUysrn5Vt36jH2KLBT2i1auw1tTSSomg8PhqNiUtx8QX2SvC9nrHu81fT41fvDUnhMjEzQgXnQjKEu3oaqMSzhSrHMxyyoEAmUHQbY/0/*)", "cjjspncu"},
+		{"wpkh(" + transcriptSlotPublicKey + ")", "y7urxfze"},
+		{"wpkh(" + transcriptWIF + ")", "m6l3y8k7"},
+		{"addr(" + transcriptAddress + ")", "tvu36900"},
+	}
+
+	for _, test := range tests {
+
+		checksum, err := descriptorChecksum(test.descriptor)
+
+		if err != nil {
+			t.Errorf("%s: %v", test.descriptor, err)
+			continue
+		}
+
+		if checksum != test.checksum {
+			t.Errorf("checksum of %s = %s, want %s", test.descriptor, checksum, test.checksum)
+		}
+
+	}
+
+	if _, err := descriptorChecksum("raw(deadbeef)\n"); err == nil {
+		t.Error("checksum of a descriptor with a character outside the input charset")
+	}
+
+}
+
+// descriptorCard returns a Satscard with slot 0 unsealed with its private key known, slot 1 unsealed
+// without it, slot 2 sealed and read, and slot 3 unused.
+func descriptorCard(t *testing.T) *Satscard {
+
+	var publicKey, otherPublicKey [33]byte
+	copy(publicKey[:], unhex(t, transcriptSlotPublicKey))
+	copy(otherPublicKey[:], seededKey("other").PubKey().SerializeCompressed())
+
+	return &Satscard{
+		Identity: "AAAAA-BBBBB-CCCCC-DDDDD-EEEEE",
+		Birth:    850000,
+		slots: []slot{
+			{state: SlotUnsealed, publicKey: publicKey, privateKey: transcriptWIF},
+			{state: SlotUnsealed},
+			{state: SlotSealed, publicKey: otherPublicKey},
+			{state: SlotUnused},
+		},
+	}
+
+}
+
+func TestSlotDescriptor(t *testing.T) {
+
+	satscard := descriptorCard(t)
+
+	otherPublicKey := seededKey("other").PubKey().SerializeCompressed()
+
+	otherDescriptor, err := addDescriptorChecksum("wpkh(" + hex.EncodeToString(otherPublicKey) + ")")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		slot      int
+		want      string
+		watchOnly string
+	}{
+		{0, "wpkh(" + transcriptWIF + ")#m6l3y8k7", "wpkh(" + transcriptSlotPublicKey + ")#y7urxfze"},
+		{1, "", ""},
+		{2, otherDescriptor, otherDescriptor},
+		{3, "", ""},
+		{4, "", ""},
+		{-1, "", ""},
+	}
+
+	for _, test := range tests {
+
+		descriptor, err := satscard.SlotDescriptor(test.slot)
+
+		if descriptor != test.want || (err != nil) != (test.want == "") {
+			t.Errorf("SlotDescriptor(%d) = %q, %v, want %q", test.slot, descriptor, err, test.want)
+		}
+
+		descriptor, err = satscard.SlotWatchOnlyDescriptor(test.slot)
+
+		if descriptor != test.watchOnly || (err != nil) != (test.watchOnly == "") {
+			t.Errorf("SlotWatchOnlyDescriptor(%d) = %q, %v, want %q", test.slot, descriptor, err, test.watchOnly)
+		}
+
+	}
+
+}
+
+func TestImportDescriptors(t *testing.T) {
+
+	satscard := descriptorCard(t)
+
+	watchOnly, err := satscard.SlotWatchOnlyDescriptor(2)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timestamp := birthTimestamp(850000)
+
+	tests := []struct {
+		name   string
+		export func() ([]byte, error)
+		want   []ImportDescriptor
+	}{
+		{"watch-only", satscard.ImportDescriptors, []ImportDescriptor{
+			{Descriptor: "wpkh(" + transcriptSlotPublicKey + ")#y7urxfze", Timestamp: timestamp, Label: "SATSCARD AAAAA-BBBBB-CCCCC-DDDDD-EEEEE slot 0"},
+			{Descriptor: watchOnly, Timestamp: timestamp, Label: "SATSCARD AAAAA-BBBBB-CCCCC-DDDDD-EEEEE slot 2"},
+		}},
+		{"private", satscard.ImportPrivateDescriptors, []ImportDescriptor{
+			{Descriptor: "wpkh(" + transcriptWIF + ")#m6l3y8k7", Timestamp: timestamp, Label: "SATSCARD AAAAA-BBBBB-CCCCC-DDDDD-EEEEE slot 0"},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			data, err := test.export()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var requests []ImportDescriptor
+
+			if err := json.Unmarshal(data, &requests); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(requests, test.want) {
+				t.Errorf("requests = %+v, want %+v", requests, test.want)
+			}
+
+		})
+	}
+
+	// A card without known keys exports an empty array rather than null
+	var empty Satscard
+
+	if data, err := empty.ImportDescriptors(); err != nil || string(data) != "[]" {
+		t.Errorf("ImportDescriptors() = %s, %v", data, err)
+	}
+
+}
+
+func TestBirthTimestamp(t *testing.T) {
+
+	const month = 30 * 24 * 60 * 60
+
+	tests := []struct {
+		name      string
+		height    int
+		timestamp int64
+	}{
+		{"unknown", 0, 0},
+		{"negative", -1, 0},
+		{"no earlier than the genesis block", 1, 1231006505},
+		{"halving", 630000, 1589225023 - month},
+		// Halfway between the first and second halvings
+		{"between halvings", 315000, 1354116278 + (1468082773-1354116278)/2 - month},
+		// Ten minutes per block after the last known halving
+		{"past the last halving", 850000, 1713571767 + 10000*600 - month},
+	}
+
+	for _, test := range tests {
+		if timestamp := birthTimestamp(test.height); timestamp != test.timestamp {
+			t.Errorf("%s: birthTimestamp(%d) = %d, want %d", test.name, test.height, timestamp, test.timestamp)
+		}
+	}
+
+}
@@ -0,0 +1,182 @@
+package tapcards
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// DumpRequest reveals the details of any slot on the card. Without a CVC it reports the state of the slot,
+// and the public key and address of an unsealed slot. With a CVC it also reveals the private key of an
+// unsealed slot.
+func (satscard *Satscard) DumpRequest(slot int, cvc string) ([]byte, error) {
+
+	slog.Debug("Request dump")
+
+	satscard.startPipeline()
+
+	if satscard.currentCardNonce == [16]byte{} {
+		satscard.queue.enqueue("status")
+	}
+
+	satscard.enqueueAuthenticated("dump", cvc)
+
+	satscard.dumpSlot = slot
+
+	return satscard.nextCommand()
+
+}
+
+func (satscard *Satscard) dumpRequest() ([]byte, error) {
+
+	if satscard.dumpSlot < 0 || satscard.dumpSlot >= satscard.NumberOfSlots {
+		return nil, fmt.Errorf("no such slot: %d", satscard.dumpSlot)
+	}
+
+	command := command{Cmd: "dump"}
+
+	dumpCommand := dumpCommand{
+		command: command,
+		Slot:    satscard.dumpSlot,
+	}
+
+	if satscard.cvc != "" {
+
+		auth, err := satscard.authenticate(satscard.cvc, command)
+
+		if err != nil {
+			return nil, err
+		}
+
+		dumpCommand.EphemeralPubKey = auth.EphemeralPubKey
+		dumpCommand.XCVC = auth.XCVC
+
+	}
+
+	return apduWrap(dumpCommand)
+
+}
+
+func (satscard *Satscard) parseDumpData(dumpData dumpData) error {
+
+	slog.Debug("Parse dump")
+
+	slog.Debug("DUMP", "Slot", dumpData.Slot)
+	slog.Debug("DUMP", "PublicKey", fmt.Sprintf("%x", dumpData.PublicKey))
+	slog.Debug("DUMP", "Address", dumpData.Address)
+	slog.Debug("DUMP", "Sealed", dumpData.Sealed)
+	slog.Debug("DUMP", "Tampered", dumpData.Tampered)
+	slog.Debug("DUMP", "CardNonce", fmt.Sprintf("%x", dumpData.CardNonce))
+
+	if err := satscard.rememberCardNonce(dumpData.CardNonce); err != nil {
+		return err
+	}
+
+	satscard.currentCardNonce = dumpData.CardNonce
+
+	if dumpData.Slot != satscard.dumpSlot || dumpData.Slot >= len(satscard.slots) {
+		return fmt.Errorf("card dumped slot %d instead of slot %d", dumpData.Slot, satscard.dumpSlot)
+	}
+
+	slot := &satscard.slots[dumpData.Slot]
+
+	switch {
+	case dumpData.Used != nil && !*dumpData.Used:
+		slot.state = SlotUnused
+		return nil
+	case dumpData.Sealed:
+		slot.state = SlotSealed
+		return nil
+	}
+
+	slot.state = SlotUnsealed
+
+	if dumpData.PrivateKey == [32]byte{} {
+
+		if dumpData.PublicKey != [33]byte{} {
+
+			address, err := paymentAddress(dumpData.PublicKey)
+
+			if err != nil {
+				return err
+			}
+
+			if dumpData.Address != "" && dumpData.Address != address {
+				return &AddressMismatchError{TruncatedAddress: dumpData.Address, DerivedAddress: address}
+			}
+
+			slot.publicKey = dumpData.PublicKey
+			slot.address = address
+
+		}
+
+		return nil
+	}
+
+	if satscard.cvc == "" {
+		return errors.New("private key revealed without authentication")
+	}
+
+	unencryptedPrivateKeyBytes, err := xor(dumpData.PrivateKey[:], satscard.sessionKey[:])
+	if err != nil {
+		return err
+	}
+
+	privateKey, _ := btcec.PrivKeyFromBytes(unencryptedPrivateKeyBytes)
+
+	var publicKey [33]byte
+	copy(publicKey[:], privateKey.PubKey().SerializeCompressed())
+
+	// The public key is only checked against the one reported by the card when it is included
+	if dumpData.PublicKey != [33]byte{} && dumpData.PublicKey != publicKey {
+		return &UnsealVerificationError{Reason: "private key does not match the reported public key"}
+	}
+
+	var readPublicKey [33]byte
+
+	if satscard.readSlot == dumpData.Slot {
+		readPublicKey = satscard.readPublicKey
+	}
+
+	err = verifySlotPrivateKey(privateKey, publicKey, readPublicKey, dumpData.MasterPrivateKey, dumpData.ChainCode)
+
+	if err != nil {
+		return err
+	}
+
+	if err := satscard.verifySlotChainCode(dumpData.Slot, dumpData.ChainCode); err != nil {
+		return err
+	}
+
+	wif, err := btcutil.NewWIF(privateKey, &chaincfg.MainNetParams, true)
+
+	if err != nil {
+		return err
+	}
+
+	address, err := paymentAddress(publicKey)
+
+	if err != nil {
+		return err
+	}
+
+	slot.publicKey = publicKey
+	slot.address = address
+	slot.privateKey = wif.String()
+
+	if dumpData.Slot == satscard.ActiveSlot {
+		satscard.ActiveSlotPrivateKey = slot.privateKey
+	}
+
+	// The private key of an interrupted unseal has now been recovered
+	if dumpData.Slot == satscard.unsealSlot {
+		satscard.unsealPending = false
+	}
+
+	return nil
+
+}
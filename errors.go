@@ -0,0 +1,100 @@
+package tapcards
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUntrustedFactoryRoot is returned when the certificate chain of a card does not lead to
+// any factory root in the session's trust store.
+var ErrUntrustedFactoryRoot = errors.New("counterfeit card: invalid factory root public key")
+
+// ErrCardNotVerified is returned in strict mode when the CVC would be sent to a card whose
+// certificate chain has not been verified.
+var ErrCardNotVerified = errors.New("card not verified: refusing to send the CVC")
+
+// ErrDifferentCard is returned when a status, including the one answering the applet select,
+// comes from a different card than the one the session is pinned to.
+var ErrDifferentCard = errors.New("different card: public key does not match")
+
+// ErrRegisteredCardMismatch is returned when a card presents a different factory root or certificate
+// chain than the one remembered by the CardRegistry under the same identity.
+var ErrRegisteredCardMismatch = errors.New("different card: certificate chain does not match the registered one")
+
+// ErrReplayedNonce is returned when a response carries a card nonce that was already received
+// during the session, which means the response was replayed.
+var ErrReplayedNonce = errors.New("replayed response: card nonce already seen")
+
+// ErrWeakNonce is returned when the source of randomness yields a nonce made of a single repeated
+// byte, which the card refuses.
+var ErrWeakNonce = errors.New("weak nonce: all bytes are equal")
+
+// CardError is returned when the card answers a command with an error response.
+type CardError struct {
+	// Code is the error code, such as 401 for a wrong CVC.
+	Code int
+	// Message is the error message reported by the card.
+	Message string
+}
+
+func (err *CardError) Error() string {
+	return fmt.Sprintf("%d: %v", err.Code, err.Message)
+}
+
+// UnsupportedCommandError is returned when a command is requested that the firmware of the card
+// does not support, before it is sent.
+type UnsupportedCommandError struct {
+	// Command is the command that was requested.
+	Command string
+	// Proto is the protocol version reported by the card.
+	Proto int
+	// Version is the firmware version reported by the card.
+	Version string
+}
+
+func (err *UnsupportedCommandError) Error() string {
+	return fmt.Sprintf("cannot %s: not supported by firmware %s (protocol %d)", err.Command, err.Version, err.Proto)
+}
+
+// ErrNotCoinkiteCard is returned when the card tapped does not have a Coinkite applet, or its
+// applet does not answer the applet select with a SATSCARD status.
+var ErrNotCoinkiteCard = errors.New("not a Coinkite card")
+
+// AddressMismatchError is returned when the address derived from the slot public key does not
+// match the truncated address reported by status.
+type AddressMismatchError struct {
+	// TruncatedAddress is the abbreviated address reported by status.
+	TruncatedAddress string
+	// DerivedAddress is the address derived from the slot public key returned by read.
+	DerivedAddress string
+}
+
+func (err *AddressMismatchError) Error() string {
+	return fmt.Sprintf("address mismatch: card reported %s, slot public key derives %s", err.TruncatedAddress, err.DerivedAddress)
+}
+
+// UnsealVerificationError is returned when the private key revealed by unseal fails verification,
+// in which case it is not handed out.
+type UnsealVerificationError struct {
+	// Reason describes the check that failed.
+	Reason string
+}
+
+func (err *UnsealVerificationError) Error() string {
+	return "unseal verification failed: " + err.Reason
+}
+
+// SlotStateError is returned when a command is refused before it is sent, because the
+// slot it affects is in the wrong state for it.
+type SlotStateError struct {
+	// Command is the command that was refused.
+	Command string
+	// Slot is the slot the command would have affected.
+	Slot int
+	// State is the current state of the slot.
+	State SlotState
+}
+
+func (err *SlotStateError) Error() string {
+	return fmt.Sprintf("cannot %s: slot %d is %v", err.Command, err.Slot, err.State)
+}
@@ -0,0 +1,94 @@
+package tapcards
+
+// EventType identifies what happened in an Event.
+type EventType int
+
+const (
+	// EventCommandSent is emitted when a command is handed out to be sent to the card.
+	EventCommandSent EventType = iota
+	// EventCommandParsed is emitted when the response to a command has been parsed.
+	EventCommandParsed
+	// EventVerificationPassed is emitted when the certificate chain of the card has been verified.
+	EventVerificationPassed
+	// EventVerificationFailed is emitted when the card fails verification.
+	EventVerificationFailed
+	// EventAuthDelayChanged is emitted when the authentication delay reported by the card changes.
+	EventAuthDelayChanged
+)
+
+func (eventType EventType) String() string {
+
+	switch eventType {
+	case EventCommandSent:
+		return "command sent"
+	case EventCommandParsed:
+		return "command parsed"
+	case EventVerificationPassed:
+		return "verification passed"
+	case EventVerificationFailed:
+		return "verification failed"
+	case EventAuthDelayChanged:
+		return "auth delay changed"
+	default:
+		return "unknown"
+	}
+
+}
+
+// Event describes progress through the commands queued for the card.
+type Event struct {
+	// Type identifies what happened.
+	Type EventType
+	// Command is the name of the command the event is about.
+	Command string
+	// Step is the position of the command in the queue, counting from 1.
+	Step int
+	// Total is the number of commands in the queue. It can grow while the queue is
+	// processed, for example when a retry refreshes the card status.
+	Total int
+	// AuthDelay is the authentication delay in seconds, for EventAuthDelayChanged.
+	AuthDelay int
+	// FactoryRoot is the name of the trusted root that matched, for EventVerificationPassed.
+	FactoryRoot string
+	// Err is the reason verification failed, for EventVerificationFailed.
+	Err error
+}
+
+// Observer is notified of the progress of a Satscard, for example to update a user interface.
+// It is called synchronously, so it should return quickly.
+type Observer interface {
+	OnEvent(event *Event)
+}
+
+// emit notifies the observer, if there is one, of an event about the command at the head of the queue.
+// Events without a step are about the command whose response is being parsed.
+func (satscard *Satscard) emit(event Event) {
+
+	if satscard.Observer == nil {
+		return
+	}
+
+	if event.Step == 0 {
+		event.Step = satscard.queue.step() - 1
+	}
+
+	if event.Total == 0 {
+		event.Total = satscard.queue.total()
+	}
+
+	satscard.Observer.OnEvent(&event)
+
+}
+
+// setAuthDelay updates the authentication delay, notifying the observer when it changes.
+func (satscard *Satscard) setAuthDelay(authDelay int) {
+
+	if authDelay == satscard.AuthDelay {
+		return
+	}
+
+	satscard.AuthDelay = authDelay
+
+	satscard.emit(Event{Type: EventAuthDelayChanged, AuthDelay: authDelay})
+
+}
@@ -0,0 +1,157 @@
+package tapcards
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// recordingObserver records the events of a Satscard.
+type recordingObserver struct {
+	events []Event
+}
+
+func (observer *recordingObserver) OnEvent(event *Event) {
+	observer.events = append(observer.events, *event)
+}
+
+// take returns the events recorded so far, and forgets them.
+func (observer *recordingObserver) take() []Event {
+
+	events := observer.events
+	observer.events = nil
+
+	return events
+
+}
+
+func TestEvents(t *testing.T) {
+
+	card := newSimulatedCard(t)
+	satscard := card.satscard()
+
+	observer := &recordingObserver{}
+	satscard.Observer = observer
+
+	sent := func(command string, step int, total int) Event {
+		return Event{Type: EventCommandSent, Command: command, Step: step, Total: total}
+	}
+
+	parsed := func(command string, step int, total int) Event {
+		return Event{Type: EventCommandParsed, Command: command, Step: step, Total: total}
+	}
+
+	authDelay := func(authDelay int) Event {
+		return Event{Type: EventAuthDelayChanged, Step: 1, Total: 1, AuthDelay: authDelay}
+	}
+
+	tests := []struct {
+		name    string
+		request func() ([]byte, error)
+		err     bool
+		want    []Event
+	}{
+		{
+			"select",
+			func() ([]byte, error) { return satscard.ISOAppletSelectRequest() },
+			false,
+			[]Event{sent("select", 1, 1), parsed("select", 1, 1)},
+		},
+		{
+			// In strict mode, the card is verified before the CVC is sent
+			"wrong CVC",
+			func() ([]byte, error) { return satscard.UnsealRequest("000000") },
+			true,
+			[]Event{
+				sent("certs", 1, 4),
+				parsed("certs", 1, 4),
+				sent("read", 2, 4),
+				parsed("read", 2, 4),
+				sent("check", 3, 4),
+				{Type: EventVerificationPassed, Command: "check", Step: 3, Total: 4, FactoryRoot: testRoot},
+				parsed("check", 3, 4),
+				sent("unseal", 4, 4),
+			},
+		},
+		{
+			"status",
+			satscard.StatusRequest,
+			false,
+			[]Event{sent("status", 1, 1), authDelay(3), parsed("status", 1, 1)},
+		},
+		{
+			"wait",
+			satscard.WaitRequest,
+			false,
+			[]Event{sent("wait", 1, 1), authDelay(2), parsed("wait", 1, 1)},
+		},
+		{
+			"wait",
+			satscard.WaitRequest,
+			false,
+			[]Event{sent("wait", 1, 1), authDelay(1), parsed("wait", 1, 1)},
+		},
+		{
+			"wait",
+			satscard.WaitRequest,
+			false,
+			[]Event{sent("wait", 1, 1), authDelay(0), parsed("wait", 1, 1)},
+		},
+		{
+			// The card has been verified already, so unseal is sent right away
+			"unseal",
+			func() ([]byte, error) { return satscard.UnsealRequest(card.cvc) },
+			false,
+			[]Event{sent("unseal", 1, 1), parsed("unseal", 1, 1)},
+		},
+	}
+
+	for _, test := range tests {
+
+		err := card.run(satscard, test.request)
+
+		if (err != nil) != test.err {
+			t.Fatalf("%s: err = %v", test.name, err)
+		}
+
+		if events := observer.take(); !reflect.DeepEqual(events, test.want) {
+			t.Errorf("%s: events = %+v, want %+v", test.name, events, test.want)
+		}
+
+	}
+
+}
+
+func TestEventsVerificationFailed(t *testing.T) {
+
+	card := newSimulatedCard(t)
+
+	// The default trust store does not trust the root of the simulated card
+	satscard := NewSatscard()
+
+	observer := &recordingObserver{}
+	satscard.Observer = observer
+
+	tap(t, card, satscard)
+
+	observer.take()
+
+	if err := card.run(satscard, satscard.CertsRequest); !errors.Is(err, ErrUntrustedFactoryRoot) {
+		t.Fatalf("err = %v, want %v", err, ErrUntrustedFactoryRoot)
+	}
+
+	events := observer.take()
+
+	last := events[len(events)-1]
+
+	if last.Type != EventVerificationFailed || last.Command != "check" || last.Step != 3 || last.Total != 3 || !errors.Is(last.Err, ErrUntrustedFactoryRoot) {
+		t.Errorf("last event = %+v, want verification of check 3/3 failed", last)
+	}
+
+	for _, event := range events {
+		if event.Type == EventVerificationPassed || event.Type == EventCommandParsed && event.Command == "check" {
+			t.Errorf("unexpected event %+v", event)
+		}
+	}
+
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"time"
 
 	"github.com/ebfe/scard"
 
@@ -44,7 +48,7 @@ func main() {
 		die(errors.New("command required"))
 	}
 
-	var satscard tapcards.Satscard
+	satscard := tapcards.NewSatscard()
 
 	tapcards.EnableDebugLogging()
 
@@ -91,25 +95,17 @@ func main() {
 		fmt.Printf("\treader: %s\n\tstate: %x\n\tactive protocol: %x\n\tatr: % x\n",
 			status.Reader, status.State, status.ActiveProtocol, status.Atr)
 
-		// INIT
-
-		cmd, err := satscard.ISOAppletSelectRequest()
+		// Cancel the operation on Ctrl-C
+		cancelCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
 
-		if err != nil {
-			die(err)
-		}
-
-		fmt.Println("Transmit:")
-		fmt.Printf("\tc-apdu: % x\n", cmd)
-		rsp, err := card.Transmit(cmd)
-		if err != nil {
-			die(err)
-		}
-		fmt.Printf("\tr-apdu: % x\n", rsp)
+		session := tapcards.NewSession(satscard, &cardTransport{card: card})
+		session.APDUTimeout = 5 * time.Second
+		session.Retry = tapcards.RetryPolicy{MaxRetries: 3, Backoff: 200 * time.Millisecond}
 
-		_, err = satscard.ParseResponse(rsp)
+		// INIT
 
-		if err != nil {
+		if _, err := session.Select(cancelCtx); err != nil {
 			die(err)
 		}
 
@@ -117,31 +113,56 @@ func main() {
 
 		// READ FROM COMMAND LINE
 
-		var request []byte
-
 		switch argsWithoutProg[0] {
 
 		case "status":
-			request, err = satscard.StatusRequest()
+			_, err = session.Status(cancelCtx)
 		case "read":
-			request, err = satscard.ReadRequest()
+			_, err = session.Read(cancelCtx)
 		case "unseal":
 
 			if len(argsWithoutProg) < 2 {
 				die(errors.New("auth required"))
 			}
 
-			request, err = satscard.UnsealRequest(argsWithoutProg[1])
+			_, err = session.Unseal(cancelCtx, argsWithoutProg[1])
 		case "certs":
-			request, err = satscard.CertsRequest()
+			_, err = session.Certs(cancelCtx)
 		case "new":
 
 			if len(argsWithoutProg) < 2 {
 				die(errors.New("auth required"))
 			}
-			request, err = satscard.NewRequest(argsWithoutProg[1])
+			_, err = session.New(cancelCtx, argsWithoutProg[1])
 		case "wait":
-			request, err = satscard.WaitRequest()
+			_, err = session.WaitForAuthDelay(cancelCtx)
+		case "dump":
+
+			if len(argsWithoutProg) < 2 {
+				die(errors.New("slot required"))
+			}
+
+			slot, err := strconv.Atoi(argsWithoutProg[1])
+			if err != nil {
+				die(err)
+			}
+
+			cvc := ""
+			if len(argsWithoutProg) > 2 {
+				cvc = argsWithoutProg[2]
+			}
+
+			_, err = session.Dump(cancelCtx, slot, cvc)
+			if err != nil {
+				die(err)
+			}
+		case "recover":
+
+			if len(argsWithoutProg) < 2 {
+				die(errors.New("auth required"))
+			}
+
+			_, err = session.Recover(cancelCtx, argsWithoutProg[1])
 
 		default:
 			die(errors.New("unknown command"))
@@ -152,32 +173,31 @@ func main() {
 			die(err)
 		}
 
-		loop(card, request, satscard.ParseResponse)
-
 		fmt.Println("Satscard", satscard)
 
 	}
 
 }
 
-func loop(card *scard.Card, request []byte, fn2 func(response []byte) ([]byte, error)) {
+// cardTransport exchanges APDUs with a card in a PC/SC reader.
+type cardTransport struct {
+	card *scard.Card
+}
 
-	for request != nil {
+// Transmit sends the command APDU to the card. PC/SC transmissions cannot be interrupted,
+// so the session stops waiting for the response when the context is done.
+func (transport *cardTransport) Transmit(ctx context.Context, command []byte) ([]byte, error) {
 
-		response, err := card.Transmit(request)
+	fmt.Println("Transmit:")
+	fmt.Printf("\tc-apdu: % x\n", command)
 
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-
-		request, err = fn2(response)
+	response, err := transport.card.Transmit(command)
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
+	fmt.Printf("\tr-apdu: % x\n", response)
 
-	}
+	return response, nil
 
 }
@@ -1,12 +1,19 @@
+//go:build tapcards_emulator
+
+// The emulator example trusts the emulator factory root, so it is built with the tapcards_emulator build tag:
+//
+//	go run -tags tapcards_emulator . status
+
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io"
-	"log"
 	"net"
 	"os"
+	"os/signal"
+	"strconv"
 	"time"
 
 	"github.com/schjonhaug/tapcards"
@@ -22,66 +29,47 @@ type Transport struct {
 	connection net.Conn
 }
 
-func (transport *Transport) sendRequest(command []byte) ([]byte, error) {
-
-	unwrappedCommand, err := transport.unwrapApdu(command)
-
+func (transport *Transport) Connect() {
+	connection, err := net.Dial("unix", "/tmp/ecard-pipe")
 	if err != nil {
-		fmt.Println(err)
-		return nil, err
+		die(err)
 	}
+	transport.connection = connection
+}
 
-	channel := make(chan []byte)
-
-	go transport.Send(unwrappedCommand, channel)
+func (transport Transport) Disconnect() {
+	transport.connection.Close()
+}
 
-	data := <-channel
+// Transmit sends the CBOR payload of the command APDU to the emulator, and wraps its reply in a response APDU.
+// The deadline of the context is applied to the connection.
+func (transport *Transport) Transmit(ctx context.Context, command []byte) ([]byte, error) {
 
-	wrappedCommand, err := transport.wrapApdu(data)
+	unwrappedCommand, err := transport.unwrapApdu(command)
 
 	if err != nil {
-		fmt.Println(err)
 		return nil, err
 	}
 
-	return wrappedCommand, nil
+	deadline, _ := ctx.Deadline()
 
-}
-
-func (transport *Transport) reader(r io.Reader, command any, channel chan []byte) {
-	buf := make([]byte, 1024)
-	_, err := r.Read(buf[:])
-
-	if err != nil {
-		die(err)
+	if err := transport.connection.SetDeadline(deadline); err != nil {
+		return nil, err
 	}
 
-	channel <- buf
-
-}
-
-func (transport *Transport) Connect() {
-	connection, err := net.Dial("unix", "/tmp/ecard-pipe")
-	if err != nil {
-		die(err)
+	if _, err := transport.connection.Write(unwrappedCommand); err != nil {
+		return nil, err
 	}
-	transport.connection = connection
-}
-
-func (transport Transport) Disconnect() {
-	transport.connection.Close()
-}
 
-func (transport Transport) Send(command []byte, channel chan []byte) {
+	buf := make([]byte, 4096)
 
-	go transport.reader(transport.connection, command, channel)
-	_, err := transport.connection.Write(command)
+	n, err := transport.connection.Read(buf)
 
 	if err != nil {
-		log.Fatal("write error:", err)
+		return nil, err
 	}
 
-	time.Sleep(100 * time.Millisecond)
+	return transport.wrapApdu(buf[:n])
 
 }
 
@@ -89,7 +77,11 @@ func (transport *Transport) unwrapApdu(data []byte) ([]byte, error) {
 
 	capdu, err := apdu.ParseCapdu(data)
 
-	return capdu.Data, err
+	if err != nil {
+		return nil, err
+	}
+
+	return capdu.Data, nil
 
 }
 
@@ -103,28 +95,6 @@ func (transport *Transport) wrapApdu(data []byte) ([]byte, error) {
 
 }
 
-func (transport *Transport) loop(request []byte, fn2 func(response []byte) ([]byte, error)) {
-
-	for request != nil {
-
-		response, err := transport.sendRequest(request)
-
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-
-		request, err = fn2(response)
-
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-
-	}
-
-}
-
 func main() {
 
 	argsWithoutProg := os.Args[1:]
@@ -133,6 +103,10 @@ func main() {
 		die(errors.New("command required"))
 	}
 
+	// Cancel the operation on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	var transport Transport
 
 	cvc := "123456"
@@ -140,28 +114,49 @@ func main() {
 	transport.Connect()
 	defer transport.Disconnect()
 
-	var satscard tapcards.Satscard
+	satscard := tapcards.NewSatscard()
 
 	tapcards.UseEmulator()
 	tapcards.EnableDebugLogging()
 
-	var request []byte
+	session := tapcards.NewSession(satscard, &transport)
+	session.APDUTimeout = 5 * time.Second
+	session.Retry = tapcards.RetryPolicy{MaxRetries: 3, Backoff: 200 * time.Millisecond}
+	session.Timeout = time.Minute
+
 	var err error
 
 	switch argsWithoutProg[0] {
 
 	case "status":
-		request, err = satscard.StatusRequest()
+		_, err = session.Status(ctx)
 	case "read":
-		request, err = satscard.ReadRequest()
+		_, err = session.Read(ctx)
 	case "unseal":
-		request, err = satscard.UnsealRequest(cvc)
+		_, err = session.Unseal(ctx, cvc)
 	case "certs":
-		request, err = satscard.CertsRequest()
+		_, err = session.Certs(ctx)
 	case "new":
-		request, err = satscard.NewRequest(cvc)
+		_, err = session.New(ctx, cvc)
 	case "wait":
-		request, err = satscard.WaitRequest()
+		_, err = session.WaitForAuthDelay(ctx)
+	case "dump":
+
+		if len(argsWithoutProg) < 2 {
+			die(errors.New("slot required"))
+		}
+
+		slot, err := strconv.Atoi(argsWithoutProg[1])
+		if err != nil {
+			die(err)
+		}
+
+		_, err = session.Dump(ctx, slot, cvc)
+		if err != nil {
+			die(err)
+		}
+	case "recover":
+		_, err = session.Recover(ctx, cvc)
 
 	default:
 		die(errors.New("unknown command"))
@@ -172,8 +167,6 @@ func main() {
 		die(err)
 	}
 
-	transport.loop(request, satscard.ParseResponse)
-
 	fmt.Println(satscard)
 
 }
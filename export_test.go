@@ -0,0 +1,41 @@
+package tapcards
+
+// SimulatedCard exposes the simulated card to the tests of package tapcards_test, which drive it
+// through transports such as faultinject.
+type SimulatedCard = simulatedCard
+
+// NewSimulatedCard returns a simulated card, as newSimulatedCard.
+var NewSimulatedCard = newSimulatedCard
+
+// Satscard returns a Satscard trusting the root of the card.
+func (card *simulatedCard) Satscard() *Satscard {
+	return card.satscard()
+}
+
+// CVC returns the CVC the card accepts.
+func (card *simulatedCard) CVC() string {
+	return card.cvc
+}
+
+// Commands returns the commands the card received, and forgets them.
+func (card *simulatedCard) Commands() []string {
+
+	card.mutex.Lock()
+	defer card.mutex.Unlock()
+
+	commands := card.commands
+	card.commands = nil
+
+	return commands
+
+}
+
+// SetSlotUnsealed unseals the first slot, so a new slot can be set up.
+func (card *simulatedCard) SetSlotUnsealed() {
+	card.slots[0].state = SlotUnsealed
+}
+
+// ActiveSlot returns the slot the card has set up last.
+func (card *simulatedCard) ActiveSlot() int {
+	return card.activeSlot
+}
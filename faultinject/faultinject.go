@@ -0,0 +1,378 @@
+// Package faultinject wraps a tapcards.Transport to inject the faults of a scripted plan, such as lost
+// or corrupted responses and cards leaving the RF field, so the handling of these failures can be
+// tested without physically removing cards.
+package faultinject
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/schjonhaug/tapcards"
+	"github.com/skythen/apdu"
+)
+
+// ErrResponseDropped is returned when the command reached the card but its response was dropped.
+var ErrResponseDropped = errors.New("fault injected: response dropped")
+
+// ErrCommandDropped is returned when the command was dropped before it reached the card.
+var ErrCommandDropped = errors.New("fault injected: command dropped")
+
+// ErrCardRemoved is returned for every exchange once the card has been removed.
+var ErrCardRemoved = errors.New("fault injected: card removed")
+
+// Kind is the kind of a fault.
+type Kind int
+
+const (
+	// DropResponse sends the command to the card and drops its response.
+	DropResponse Kind = iota + 1
+	// DropCommand drops the command before it reaches the card.
+	DropCommand
+	// Truncate sends the command to the card and cuts its response down to Length bytes.
+	Truncate
+	// FlipBit sends the command to the card and flips bit Bit of the data in its response.
+	FlipBit
+	// StatusWord answers with the status word SW1 SW2 instead of sending the command to the card.
+	StatusWord
+	// Delay waits for Delay before sending the command to the card, or until the context is done.
+	Delay
+	// RemoveCard drops the command, and every exchange after it, as if the card left the RF field.
+	RemoveCard
+)
+
+func (kind Kind) String() string {
+
+	switch kind {
+	case DropResponse:
+		return "drop response"
+	case DropCommand:
+		return "drop command"
+	case Truncate:
+		return "truncate"
+	case FlipBit:
+		return "flip bit"
+	case StatusWord:
+		return "status word"
+	case Delay:
+		return "delay"
+	case RemoveCard:
+		return "remove card"
+	default:
+		return "unknown"
+	}
+
+}
+
+// Fault is something that goes wrong with a single exchange.
+type Fault struct {
+	// Kind is the kind of the fault.
+	Kind Kind
+	// Length is the number of bytes kept of the response, for Truncate. It must not be negative.
+	Length int
+	// Bit is the bit of the response data to flip, counting from the first bit of the first byte, for FlipBit.
+	// It wraps around the length of the data, and must not be negative.
+	Bit int
+	// SW1 and SW2 are the status word returned, for StatusWord.
+	SW1 byte
+	SW2 byte
+	// Delay is how long to wait, for Delay.
+	Delay time.Duration
+}
+
+// validate returns an error if the fault cannot be injected.
+func (fault Fault) validate() error {
+
+	switch {
+	case fault.Kind == Truncate && fault.Length < 0:
+		return fmt.Errorf("invalid fault: negative length %d", fault.Length)
+	case fault.Kind == FlipBit && fault.Bit < 0:
+		return fmt.Errorf("invalid fault: negative bit %d", fault.Bit)
+	}
+
+	return nil
+
+}
+
+// step is a fault scheduled in a plan.
+type step struct {
+	// exchange is the exchange the fault is injected into, counting from 1, or 0 to match on command.
+	exchange int
+	// command is the command the fault is injected into the first exchange of.
+	command string
+	// fault is the fault to inject.
+	fault Fault
+	// done is set once the fault has been injected.
+	done bool
+}
+
+// Plan is a script of faults. Each fault is injected once.
+type Plan struct {
+	// RemoveAfter removes the card after this number of exchanges. Zero means never.
+	RemoveAfter int
+
+	steps []step
+}
+
+// NewPlan returns an empty plan.
+func NewPlan() *Plan {
+
+	return &Plan{}
+
+}
+
+// At injects the fault into the given exchange, counting from 1.
+func (plan *Plan) At(exchange int, fault Fault) *Plan {
+
+	plan.steps = append(plan.steps, step{exchange: exchange, fault: fault})
+
+	return plan
+
+}
+
+// OnCommand injects the fault into the next exchange that sends the given command, such as "unseal"
+// or "new". The applet select is matched as "select" and GET RESPONSE as "get_response".
+func (plan *Plan) OnCommand(command string, fault Fault) *Plan {
+
+	plan.steps = append(plan.steps, step{command: command, fault: fault})
+
+	return plan
+
+}
+
+// Transport is a tapcards.Transport that injects the faults of a plan into the exchanges with the
+// wrapped transport.
+type Transport struct {
+	// Transport is the transport to the card, or an emulator.
+	Transport tapcards.Transport
+	// Plan is the script of faults to inject.
+	Plan *Plan
+
+	mutex     sync.Mutex
+	exchanges int
+	removed   bool
+	// removedAfter is set once the card has been removed by RemoveAfter, so it stays in the field
+	// once reinserted.
+	removedAfter bool
+	injected     []Kind
+}
+
+// New returns a transport injecting the faults of the plan into the exchanges with the transport.
+func New(transport tapcards.Transport, plan *Plan) *Transport {
+
+	return &Transport{Transport: transport, Plan: plan}
+
+}
+
+// Transmit sends the command to the wrapped transport, injecting any fault scheduled for the exchange.
+func (transport *Transport) Transmit(ctx context.Context, command []byte) ([]byte, error) {
+
+	transport.mutex.Lock()
+
+	transport.exchanges++
+
+	exchange := transport.exchanges
+	name := commandName(command)
+
+	if !transport.removedAfter && transport.Plan != nil && transport.Plan.RemoveAfter > 0 && exchange > transport.Plan.RemoveAfter {
+		transport.removed = true
+		transport.removedAfter = true
+	}
+
+	if transport.removed {
+
+		transport.mutex.Unlock()
+
+		return nil, ErrCardRemoved
+	}
+
+	fault, ok := transport.next(exchange, name)
+
+	if ok {
+
+		if err := fault.validate(); err != nil {
+
+			transport.mutex.Unlock()
+
+			return nil, err
+		}
+
+		slog.Debug("FAULT", "Exchange", exchange, "Command", name, "Kind", fault.Kind)
+
+		transport.injected = append(transport.injected, fault.Kind)
+
+		if fault.Kind == RemoveCard {
+			transport.removed = true
+		}
+
+	}
+
+	transport.mutex.Unlock()
+
+	if !ok {
+		return transport.Transport.Transmit(ctx, command)
+	}
+
+	switch fault.Kind {
+
+	case DropCommand:
+		return nil, ErrCommandDropped
+	case RemoveCard:
+		return nil, ErrCardRemoved
+	case StatusWord:
+		return []byte{fault.SW1, fault.SW2}, nil
+	case Delay:
+
+		timer := time.NewTimer(fault.Delay)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		return transport.Transport.Transmit(ctx, command)
+
+	}
+
+	response, err := transport.Transport.Transmit(ctx, command)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch fault.Kind {
+
+	case DropResponse:
+		return nil, ErrResponseDropped
+	case Truncate:
+
+		if fault.Length < len(response) {
+			response = response[:fault.Length]
+		}
+
+		return response, nil
+
+	case FlipBit:
+
+		// Leave the status word alone, so the corruption reaches the CBOR payload
+		if len(response) > 2 {
+
+			response = append([]byte(nil), response...)
+
+			bit := fault.Bit % ((len(response) - 2) * 8)
+
+			response[bit/8] ^= 0x80 >> (bit % 8)
+
+		}
+
+		return response, nil
+
+	default:
+		return nil, fmt.Errorf("unknown fault: %v", fault.Kind)
+
+	}
+
+}
+
+// Exchanges returns the number of exchanges attempted so far, including the faulty ones.
+func (transport *Transport) Exchanges() int {
+
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	return transport.exchanges
+
+}
+
+// Injected returns the kinds of the faults injected so far, in order.
+func (transport *Transport) Injected() []Kind {
+
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	return append([]Kind(nil), transport.injected...)
+
+}
+
+// Removed reports whether the card has been removed.
+func (transport *Transport) Removed() bool {
+
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	return transport.removed
+
+}
+
+// Reinsert puts the card back into the RF field after it was removed. A card removed by RemoveAfter
+// is only removed once, so it stays in the field from then on.
+func (transport *Transport) Reinsert() {
+
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	transport.removed = false
+
+}
+
+// next returns the fault scheduled for the exchange, if any, and marks it as injected.
+func (transport *Transport) next(exchange int, command string) (Fault, bool) {
+
+	if transport.Plan == nil {
+		return Fault{}, false
+	}
+
+	for i := range transport.Plan.steps {
+
+		step := &transport.Plan.steps[i]
+
+		if step.done {
+			continue
+		}
+
+		if step.exchange == exchange || (step.exchange == 0 && step.command == command) {
+
+			step.done = true
+
+			return step.fault, true
+		}
+
+	}
+
+	return Fault{}, false
+
+}
+
+// commandName returns the name of the command in a command APDU.
+func commandName(command []byte) string {
+
+	capdu, err := apdu.ParseCapdu(command)
+
+	if err != nil {
+		return ""
+	}
+
+	switch capdu.Ins {
+	case 0xA4:
+		return "select"
+	case 0xC0:
+		return "get_response"
+	}
+
+	var cmd struct {
+		Cmd string `cbor:"cmd"`
+	}
+
+	if err := cbor.Unmarshal(capdu.Data, &cmd); err != nil {
+		return ""
+	}
+
+	return cmd.Cmd
+
+}
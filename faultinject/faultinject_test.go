@@ -0,0 +1,216 @@
+package faultinject
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/bits"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// statusResponse is the response the fake card answers every command with.
+var statusResponse = []byte{0xa1, 0x65, 'p', 'r', 'o', 't', 'o', 0x01, 0x90, 0x00}
+
+// fakeCard is a tapcards.Transport that records the commands it receives.
+type fakeCard struct {
+	commands [][]byte
+}
+
+func (card *fakeCard) Transmit(ctx context.Context, command []byte) ([]byte, error) {
+
+	card.commands = append(card.commands, command)
+
+	return append([]byte(nil), statusResponse...), nil
+
+}
+
+// commandAPDU returns a command APDU sending the given command.
+func commandAPDU(t *testing.T, cmd string) []byte {
+
+	data, err := cbor.Marshal(map[string]string{"cmd": cmd})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append([]byte{0x00, 0xcb, 0x00, 0x00, byte(len(data))}, data...)
+
+}
+
+func TestFaults(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		fault    Fault
+		response []byte
+		err      error
+		sent     bool
+	}{
+		{"drop response", Fault{Kind: DropResponse}, nil, ErrResponseDropped, true},
+		{"drop command", Fault{Kind: DropCommand}, nil, ErrCommandDropped, false},
+		{"truncate", Fault{Kind: Truncate, Length: 3}, statusResponse[:3], nil, true},
+		{"truncate to nothing", Fault{Kind: Truncate}, []byte{}, nil, true},
+		{"truncate beyond the response", Fault{Kind: Truncate, Length: 100}, statusResponse, nil, true},
+		{"status word", Fault{Kind: StatusWord, SW1: 0x6a, SW2: 0x82}, []byte{0x6a, 0x82}, nil, false},
+		{"delay", Fault{Kind: Delay, Delay: time.Millisecond}, statusResponse, nil, true},
+		{"remove card", Fault{Kind: RemoveCard}, nil, ErrCardRemoved, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			card := &fakeCard{}
+			transport := New(card, NewPlan().At(1, test.fault))
+
+			response, err := transport.Transmit(context.Background(), commandAPDU(t, "status"))
+
+			if !errors.Is(err, test.err) {
+				t.Fatalf("err = %v, want %v", err, test.err)
+			}
+
+			if !bytes.Equal(response, test.response) {
+				t.Errorf("response = %x, want %x", response, test.response)
+			}
+
+			if sent := len(card.commands) == 1; sent != test.sent {
+				t.Errorf("command sent = %v, want %v", sent, test.sent)
+			}
+
+			if injected := transport.Injected(); len(injected) != 1 || injected[0] != test.fault.Kind {
+				t.Errorf("injected = %v, want [%v]", injected, test.fault.Kind)
+			}
+
+		})
+	}
+
+}
+
+func TestFlipBit(t *testing.T) {
+
+	for _, bit := range []int{0, 7, 8, 63, 64, 1000} {
+
+		transport := New(&fakeCard{}, NewPlan().At(1, Fault{Kind: FlipBit, Bit: bit}))
+
+		response, err := transport.Transmit(context.Background(), commandAPDU(t, "status"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(response) != len(statusResponse) {
+			t.Fatalf("bit %d: response = %x, want %d bytes", bit, response, len(statusResponse))
+		}
+
+		// Exactly one bit of the data differs, and the status word is left alone
+		flipped := 0
+
+		for i := range response {
+			flipped += bits.OnesCount8(response[i] ^ statusResponse[i])
+		}
+
+		if flipped != 1 || !bytes.Equal(response[len(response)-2:], []byte{0x90, 0x00}) {
+			t.Errorf("bit %d: response = %x, want one bit of %x flipped", bit, response, statusResponse)
+		}
+
+	}
+
+}
+
+func TestInvalidFaults(t *testing.T) {
+
+	for _, fault := range []Fault{{Kind: Truncate, Length: -1}, {Kind: FlipBit, Bit: -1}} {
+
+		card := &fakeCard{}
+		transport := New(card, NewPlan().At(1, fault))
+
+		if _, err := transport.Transmit(context.Background(), commandAPDU(t, "status")); err == nil {
+			t.Errorf("%v fault %+v was injected", fault.Kind, fault)
+		}
+
+		if len(card.commands) != 0 {
+			t.Errorf("%v fault %+v sent the command", fault.Kind, fault)
+		}
+
+	}
+
+}
+
+func TestDelayCancelled(t *testing.T) {
+
+	card := &fakeCard{}
+	transport := New(card, NewPlan().At(1, Fault{Kind: Delay, Delay: time.Hour}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	if _, err := transport.Transmit(ctx, commandAPDU(t, "status")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if len(card.commands) != 0 {
+		t.Error("command sent after the delay was cancelled")
+	}
+
+}
+
+func TestOnCommand(t *testing.T) {
+
+	card := &fakeCard{}
+	transport := New(card, NewPlan().OnCommand("unseal", Fault{Kind: DropResponse}))
+
+	for _, cmd := range []string{"status", "unseal", "unseal"} {
+
+		_, err := transport.Transmit(context.Background(), commandAPDU(t, cmd))
+
+		// Only the first unseal is faulty
+		if want := cmd == "unseal" && len(card.commands) == 2; errors.Is(err, ErrResponseDropped) != want {
+			t.Errorf("%s: err = %v", cmd, err)
+		}
+
+	}
+
+	if len(card.commands) != 3 {
+		t.Errorf("%d commands sent, want 3", len(card.commands))
+	}
+
+}
+
+func TestRemoveAndReinsert(t *testing.T) {
+
+	plan := NewPlan()
+	plan.RemoveAfter = 1
+
+	card := &fakeCard{}
+	transport := New(card, plan)
+
+	exchanges := []error{nil, ErrCardRemoved, ErrCardRemoved}
+
+	for i, want := range exchanges {
+		if _, err := transport.Transmit(context.Background(), commandAPDU(t, "status")); !errors.Is(err, want) {
+			t.Errorf("exchange %d: err = %v, want %v", i+1, err, want)
+		}
+	}
+
+	if !transport.Removed() {
+		t.Error("card not removed")
+	}
+
+	transport.Reinsert()
+
+	// The card removed by RemoveAfter stays in the field, and the plan is left alone
+	if _, err := transport.Transmit(context.Background(), commandAPDU(t, "status")); err != nil {
+		t.Errorf("exchange after reinsert: err = %v", err)
+	}
+
+	if plan.RemoveAfter != 1 {
+		t.Errorf("RemoveAfter = %d, want 1", plan.RemoveAfter)
+	}
+
+	if transport.Exchanges() != 4 || len(card.commands) != 2 {
+		t.Errorf("%d exchanges and %d commands sent, want 4 and 2", transport.Exchanges(), len(card.commands))
+	}
+
+}
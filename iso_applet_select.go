@@ -1,19 +1,85 @@
 package tapcards
 
 import (
+	"fmt"
+	"log/slog"
+
 	"github.com/skythen/apdu"
 )
 
+// CoinkiteAID is the application identifier of the Coinkite applet on SATSCARD and TAPSIGNER.
+var CoinkiteAID = []byte{0xf0, 'C', 'o', 'i', 'n', 'k', 'i', 't', 'e', 'C', 'A', 'R', 'D', 'v', '1'}
+
+// statusFields are the fields every status response from a SATSCARD includes.
+var statusFields = []string{"proto", "ver", "pubkey", "card_nonce", "slots"}
+
 // ISO Applet Select
-func (satscard *Satscard) ISOAppletSelectRequest() ([]byte, error) {
+//
+// ISOAppletSelectRequest selects the applet with the first of the given AIDs, or CoinkiteAID if none
+// are given. If the card does not have that applet, the next AID is tried. The response must be a
+// status from a SATSCARD, otherwise ErrNotCoinkiteCard is returned.
+func (satscard *Satscard) ISOAppletSelectRequest(aids ...[]byte) ([]byte, error) {
+
+	satscard.startPipeline()
+
+	if len(aids) == 0 {
+		aids = [][]byte{CoinkiteAID}
+	}
+
+	satscard.selectAIDs = aids
 
 	// ISO Applet Select is equivalent to doing a "status" command
-	satscard.queue.enqueue("status")
+	satscard.queue.enqueue("select")
 
-	data := []byte{0xf0, 'C', 'o', 'i', 'n', 'k', 'i', 't', 'e', 'C', 'A', 'R', 'D', 'v', '1'}
+	return satscard.nextCommand()
 
-	capdu := apdu.Capdu{Cla: 0x00, Ins: 0xa4, P1: 0x04, Data: data}
+}
+
+func (satscard *Satscard) selectRequest() ([]byte, error) {
+
+	slog.Debug("Request select", "AID", fmt.Sprintf("%x", satscard.selectAIDs[0]))
+
+	capdu := apdu.Capdu{Cla: 0x00, Ins: 0xa4, P1: 0x04, Data: satscard.selectAIDs[0]}
 
 	return capdu.Bytes()
 
 }
+
+// selectNextAID tries the next AID after the card failed to select the applet.
+func (satscard *Satscard) selectNextAID(err error) ([]byte, error) {
+
+	if len(satscard.selectAIDs) <= 1 {
+		return nil, fmt.Errorf("%w: %v", ErrNotCoinkiteCard, err)
+	}
+
+	slog.Debug("Applet not selected", "AID", fmt.Sprintf("%x", satscard.selectAIDs[0]), "Error", err)
+
+	satscard.selectAIDs = satscard.selectAIDs[1:]
+
+	return satscard.nextCommand()
+
+}
+
+// parseSelectData makes sure the response to the applet select is a status from a SATSCARD,
+// and parses it as such.
+func (satscard *Satscard) parseSelectData(data []byte) error {
+
+	var fields map[string]interface{}
+
+	if err := tolerantDecMode.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("%w: %v", ErrNotCoinkiteCard, err)
+	}
+
+	if _, ok := fields["error"]; !ok {
+
+		for _, field := range statusFields {
+			if _, ok := fields[field]; !ok {
+				return fmt.Errorf("%w: status without %s", ErrNotCoinkiteCard, field)
+			}
+		}
+
+	}
+
+	return parseResponseData(satscard, "status", data, satscard.parseStatusData)
+
+}
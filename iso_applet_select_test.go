@@ -0,0 +1,167 @@
+package tapcards
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// selectCommand returns the applet select of the AID.
+func selectCommand(aid []byte) []byte {
+	return append([]byte{0x00, 0xa4, 0x04, 0x00, byte(len(aid))}, aid...)
+}
+
+func TestISOAppletSelectNotCoinkiteCard(t *testing.T) {
+
+	withoutPublicKey, err := cbor.Marshal(map[string]interface{}{"proto": 1, "ver": "1.0.3", "card_nonce": make([]byte, 16), "slots": []int{0, 10}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		response []byte
+	}{
+		// The FCI template another applet answers the select with
+		{"FCI template", unhex(t, "6f108408a000000151000000a5049f6501ff9000")},
+		{"no data", []byte{0x90, 0x00}},
+		{"CBOR without pubkey", append(withoutPublicKey, 0x90, 0x00)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			satscard := NewSatscard()
+
+			if _, err := satscard.ISOAppletSelectRequest(); err != nil {
+				t.Fatal(err)
+			}
+
+			request, err := satscard.ParseResponse(test.response)
+
+			if !errors.Is(err, ErrNotCoinkiteCard) || request != nil {
+				t.Fatalf("request %x, err %v, want %v", request, err, ErrNotCoinkiteCard)
+			}
+
+			var syntaxError *cbor.SyntaxError
+
+			if errors.As(err, &syntaxError) {
+				t.Errorf("CBOR error %v returned", syntaxError)
+			}
+
+			if satscard.Identity != "" || satscard.queue.size() != 0 {
+				t.Errorf("identity %q, queue %v", satscard.Identity, satscard.queue.elements)
+			}
+
+		})
+	}
+
+}
+
+func TestISOAppletSelectNextAID(t *testing.T) {
+
+	card := newSimulatedCard(t)
+	satscard := card.satscard()
+
+	otherAID := []byte{0xa0, 0x00, 0x00, 0x01, 0x51}
+
+	request, err := satscard.ISOAppletSelectRequest(otherAID, CoinkiteAID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(request, selectCommand(otherAID)) {
+		t.Fatalf("request = %x, want %x", request, selectCommand(otherAID))
+	}
+
+	// The card does not have the first applet, so the next AID is selected
+	request, err = satscard.ParseResponse([]byte{0x6a, 0x82})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(request, selectCommand(CoinkiteAID)) {
+		t.Fatalf("request = %x, want %x", request, selectCommand(CoinkiteAID))
+	}
+
+	response, err := card.Transmit(context.Background(), request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if request, err := satscard.ParseResponse(response); err != nil || request != nil {
+		t.Fatalf("request %x, err %v", request, err)
+	}
+
+	if satscard.Identity != card.satscardIdentity() || satscard.ActiveSlotState() != SlotSealed {
+		t.Errorf("status not parsed: identity %q, slot %v", satscard.Identity, satscard.ActiveSlotState())
+	}
+
+}
+
+func TestISOAppletSelectAIDsExhausted(t *testing.T) {
+
+	tests := []struct {
+		name string
+		aids [][]byte
+		// responses are the status words the card answers each select with
+		responses []string
+	}{
+		{"default AID", nil, []string{"6a82"}},
+		{"every AID", [][]byte{{0xa0, 0x01}, {0xa0, 0x02}, CoinkiteAID}, []string{"6a82", "6a82", "6d00"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			satscard := NewSatscard()
+
+			request, err := satscard.ISOAppletSelectRequest(test.aids...)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, response := range test.responses {
+
+				aid := CoinkiteAID
+
+				if test.aids != nil {
+					aid = test.aids[i]
+				}
+
+				if !bytes.Equal(request, selectCommand(aid)) {
+					t.Fatalf("select %d: request = %x, want %x", i+1, request, selectCommand(aid))
+				}
+
+				request, err = satscard.ParseResponse(unhex(t, response))
+
+				if i < len(test.responses)-1 && err != nil {
+					t.Fatalf("select %d: %v", i+1, err)
+				}
+
+			}
+
+			// The last status word is reported
+			last := strings.ToUpper(test.responses[len(test.responses)-1])
+
+			if !errors.Is(err, ErrNotCoinkiteCard) || !strings.Contains(err.Error(), last) || request != nil {
+				t.Fatalf("request %x, err %v, want %v with %s", request, err, ErrNotCoinkiteCard, last)
+			}
+
+			if satscard.queue.size() != 0 {
+				t.Errorf("queue %v left behind", satscard.queue.elements)
+			}
+
+		})
+	}
+
+}
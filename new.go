@@ -2,6 +2,7 @@ package tapcards
 
 import (
 	"errors"
+	"io"
 	"log/slog"
 )
 
@@ -9,13 +10,18 @@ func (satscard *Satscard) NewRequest(cvc string) ([]byte, error) {
 
 	slog.Debug("Request new")
 
+	satscard.startPipeline()
+
+	// Fail before the CVC is used, as the card would refuse the command and delay the next attempt
+	if err := satscard.requireActiveSlotState("new", SlotUnsealed); err != nil {
+		return nil, err
+	}
+
 	if satscard.currentCardNonce == [16]byte{} {
 		satscard.queue.enqueue("status")
 	}
 
-	satscard.queue.enqueue("new")
-
-	satscard.cvc = cvc
+	satscard.enqueueAuthenticated("new", cvc)
 
 	return satscard.nextCommand()
 
@@ -26,10 +32,20 @@ func (satscard *Satscard) newRequest() ([]byte, error) {
 	// Check if we can open the next slot
 	if satscard.ActiveSlot+1 >= satscard.NumberOfSlots {
 
+		satscard.cvc = ""
+
 		return nil, errors.New("no more slots available")
 
 	}
 
+	if err := satscard.requireActiveSlotState("new", SlotUnsealed); err != nil {
+
+		satscard.cvc = ""
+
+		return nil, err
+
+	}
+
 	command := command{Cmd: "new"}
 
 	auth, err := satscard.authenticate(satscard.cvc, command)
@@ -44,6 +60,23 @@ func (satscard *Satscard) newRequest() ([]byte, error) {
 		auth:    *auth,
 	}
 
+	// Firmware that accepts it mixes a chain code picked by the app into the key of the new slot,
+	// so the key is not left to the card alone
+	if capabilities := satscard.Capabilities(); capabilities != nil && capabilities.ChainCodeOnNew {
+
+		newCommand.ChainCode = make([]byte, 32)
+
+		if _, err := io.ReadFull(satscard.random(), newCommand.ChainCode); err != nil {
+			return nil, err
+		}
+
+	}
+
+	// Kept to check that the card used it once the slot is unsealed
+	satscard.newChainCode = newCommand.ChainCode
+	satscard.newSlot = satscard.ActiveSlot
+	satscard.newPending = true
+
 	return apduWrap(newCommand)
 
 }
@@ -53,8 +86,21 @@ func (satscard *Satscard) parseNewData(newData newData) error {
 	slog.Debug("Parse new")
 	slog.Debug("NEW", "Slot", newData.Slot)
 
+	if err := satscard.rememberCardNonce(newData.CardNonce); err != nil {
+		return err
+	}
+
 	satscard.currentCardNonce = newData.CardNonce
+	satscard.newPending = false
 	satscard.ActiveSlot = newData.Slot
+	satscard.setSlotState(newData.Slot, SlotSealed)
+	satscard.setSlotChainCode(newData.Slot, satscard.newChainCode)
+	satscard.newChainCode = nil
+
+	// The addresses and public key belong to the previous slot
+	satscard.ActiveSlotPaymentAddress = ""
+	satscard.ActiveSlotTruncatedPaymentAddress = ""
+	satscard.activeSlotPublicKey = [33]byte{}
 
 	return nil
 
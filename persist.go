@@ -0,0 +1,226 @@
+package tapcards
+
+import (
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// sessionStateVersion is the version of the format written by MarshalBinary.
+const sessionStateVersion = 1
+
+// sessionState is the non-secret state of a Satscard that survives between taps.
+// The CVC, session key and private keys are never included.
+type sessionState struct {
+	Version int `cbor:"version"`
+
+	ActiveSlot                        int    `cbor:"active_slot"`
+	NumberOfSlots                     int    `cbor:"number_of_slots"`
+	Identity                          string `cbor:"identity"`
+	ActiveSlotPaymentAddress          string `cbor:"active_slot_payment_address"`
+	ActiveSlotTruncatedPaymentAddress string `cbor:"active_slot_truncated_payment_address"`
+	Proto                             int    `cbor:"proto"`
+	Birth                             int    `cbor:"birth"`
+	FirmwareVersion                   string `cbor:"firmware_version"`
+	AuthDelay                         int    `cbor:"auth_delay"`
+
+	CardPublicKey       [33]byte     `cbor:"card_public_key"`
+	CurrentCardNonce    [16]byte     `cbor:"current_card_nonce"`
+	SeenCardNonces      [][16]byte   `cbor:"seen_card_nonces"`
+	CertificateChain    [][65]byte   `cbor:"certificate_chain"`
+	ActiveSlotPublicKey [33]byte     `cbor:"active_slot_public_key"`
+	CheckChallenge      *challenge   `cbor:"check_challenge"`
+	ReadChallenge       *challenge   `cbor:"read_challenge"`
+	ReadSlot            int          `cbor:"read_slot"`
+	ReadPublicKey       [33]byte     `cbor:"read_public_key"`
+	UnsealSlot          int          `cbor:"unseal_slot"`
+	UnsealPending       bool         `cbor:"unseal_pending"`
+	NewSlot             int          `cbor:"new_slot"`
+	NewPending          bool         `cbor:"new_pending"`
+	NewChainCode        []byte       `cbor:"new_chain_code,omitempty"`
+	Slots               []slotRecord `cbor:"slots"`
+}
+
+// challenge is the serialized form of a signedChallenge.
+type challenge struct {
+	CardNonce [16]byte `cbor:"card_nonce"`
+	AppNonce  []byte   `cbor:"app_nonce"`
+	Signature [64]byte `cbor:"signature"`
+}
+
+// slotRecord is the serialized form of a slot, without its private key.
+type slotRecord struct {
+	State     SlotState `cbor:"state"`
+	PublicKey [33]byte  `cbor:"public_key"`
+	Address   string    `cbor:"address"`
+	ChainCode []byte    `cbor:"chain_code,omitempty"`
+}
+
+// MarshalBinary encodes the non-secret state of the session, so it can be restored with
+// UnmarshalBinary after the app has been stopped between taps. The CVC, session key and
+// private keys are not included.
+func (satscard *Satscard) MarshalBinary() ([]byte, error) {
+
+	state := sessionState{
+		Version:                           sessionStateVersion,
+		ActiveSlot:                        satscard.ActiveSlot,
+		NumberOfSlots:                     satscard.NumberOfSlots,
+		Identity:                          satscard.Identity,
+		ActiveSlotPaymentAddress:          satscard.ActiveSlotPaymentAddress,
+		ActiveSlotTruncatedPaymentAddress: satscard.ActiveSlotTruncatedPaymentAddress,
+		Proto:                             satscard.Proto,
+		Birth:                             satscard.Birth,
+		FirmwareVersion:                   satscard.Version,
+		AuthDelay:                         satscard.AuthDelay,
+		CardPublicKey:                     satscard.cardPublicKey,
+		CurrentCardNonce:                  satscard.currentCardNonce,
+		CertificateChain:                  satscard.certificateChain,
+		ActiveSlotPublicKey:               satscard.activeSlotPublicKey,
+		CheckChallenge:                    newChallenge(satscard.checkChallenge),
+		ReadChallenge:                     newChallenge(satscard.readChallenge),
+		ReadSlot:                          satscard.readSlot,
+		ReadPublicKey:                     satscard.readPublicKey,
+		UnsealSlot:                        satscard.unsealSlot,
+		UnsealPending:                     satscard.unsealPending,
+		NewSlot:                           satscard.newSlot,
+		NewPending:                        satscard.newPending,
+		NewChainCode:                      satscard.newChainCode,
+	}
+
+	for nonce := range satscard.seenCardNonces {
+		state.SeenCardNonces = append(state.SeenCardNonces, nonce)
+	}
+
+	for _, slot := range satscard.slots {
+		state.Slots = append(state.Slots, slotRecord{State: slot.state, PublicKey: slot.publicKey, Address: slot.address, ChainCode: slot.chainCode})
+	}
+
+	return cbor.Marshal(state)
+
+}
+
+// UnmarshalBinary restores the state encoded by MarshalBinary. A restored session skips
+// status when the same card is tapped again, and in strict mode skips certs if the card
+// was verified before. Strict itself is not part of the state, so the restored session keeps
+// the mode it was created with.
+//
+// The verification results are not trusted as stored. They are recomputed against the
+// session's trust store, so set TrustStore before calling UnmarshalBinary if the default
+// is not used. If the state cannot be decoded or verified, the session is left unchanged.
+func (satscard *Satscard) UnmarshalBinary(data []byte) error {
+
+	var state sessionState
+
+	if err := cbor.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	if state.Version != sessionStateVersion {
+		return fmt.Errorf("unsupported session state version: %d", state.Version)
+	}
+
+	checkChallenge := state.CheckChallenge.signedChallenge()
+
+	// Recompute the verification results instead of trusting the stored ones
+	var factoryRoot string
+	var verified bool
+
+	if checkChallenge != nil && state.CardPublicKey != [33]byte{} {
+
+		stored := evidence{
+			cardPublicKey:    state.CardPublicKey,
+			certificateChain: state.CertificateChain,
+			check:            checkChallenge,
+			read:             state.ReadChallenge.signedChallenge(),
+			slot:             state.ReadSlot,
+			slotPublicKey:    state.ReadPublicKey,
+			statusAddress:    state.ActiveSlotTruncatedPaymentAddress,
+		}
+
+		report, err := stored.verify(satscard.trustStore())
+
+		if err != nil {
+			return err
+		}
+
+		if report.Genuine {
+			factoryRoot = report.FactoryRoot
+			verified = true
+		}
+
+	}
+
+	satscard.Abort()
+
+	satscard.ActiveSlot = state.ActiveSlot
+	satscard.NumberOfSlots = state.NumberOfSlots
+	satscard.Identity = state.Identity
+	satscard.ActiveSlotPaymentAddress = state.ActiveSlotPaymentAddress
+	satscard.ActiveSlotTruncatedPaymentAddress = state.ActiveSlotTruncatedPaymentAddress
+	satscard.ActiveSlotPrivateKey = ""
+	satscard.Proto = state.Proto
+	satscard.Birth = state.Birth
+	satscard.Version = state.FirmwareVersion
+	satscard.AuthDelay = state.AuthDelay
+	satscard.FactoryRoot = factoryRoot
+
+	satscard.cardPublicKey = state.CardPublicKey
+	satscard.currentCardNonce = state.CurrentCardNonce
+	satscard.certificateChain = state.CertificateChain
+	satscard.activeSlotPublicKey = state.ActiveSlotPublicKey
+	satscard.checkChallenge = checkChallenge
+	satscard.readChallenge = state.ReadChallenge.signedChallenge()
+	satscard.readSlot = state.ReadSlot
+	satscard.readPublicKey = state.ReadPublicKey
+	satscard.unsealSlot = state.UnsealSlot
+	satscard.unsealPending = state.UnsealPending
+	satscard.newSlot = state.NewSlot
+	satscard.newPending = state.NewPending
+	satscard.newChainCode = state.NewChainCode
+	satscard.verified = verified
+
+	satscard.seenCardNonces = make(map[[16]byte]struct{}, len(state.SeenCardNonces))
+
+	for _, nonce := range state.SeenCardNonces {
+		satscard.seenCardNonces[nonce] = struct{}{}
+	}
+
+	satscard.slots = nil
+
+	for _, record := range state.Slots {
+		satscard.slots = append(satscard.slots, slot{state: record.State, publicKey: record.PublicKey, address: record.Address, chainCode: record.ChainCode})
+	}
+
+	return nil
+
+}
+
+// newChallenge converts a signedChallenge into its serialized form.
+func newChallenge(signedChallenge *signedChallenge) *challenge {
+
+	if signedChallenge == nil {
+		return nil
+	}
+
+	return &challenge{
+		CardNonce: signedChallenge.cardNonce,
+		AppNonce:  signedChallenge.appNonce,
+		Signature: signedChallenge.signature,
+	}
+
+}
+
+// signedChallenge converts the serialized form back into a signedChallenge.
+func (challenge *challenge) signedChallenge() *signedChallenge {
+
+	if challenge == nil {
+		return nil
+	}
+
+	return &signedChallenge{
+		cardNonce: challenge.CardNonce,
+		appNonce:  challenge.AppNonce,
+		signature: challenge.Signature,
+	}
+
+}
@@ -0,0 +1,69 @@
+package tapcards
+
+import (
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+func TestUnmarshalBinaryKeepsStrict(t *testing.T) {
+
+	strict := NewSatscard()
+	strict.Identity = "AAAAA-BBBBB-CCCCC-DDDDD-EEEEE"
+
+	data, err := strict.MarshalBinary()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var satscard Satscard
+
+	if err := satscard.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if satscard.Strict {
+		t.Error("strict mode was restored")
+	}
+
+	if satscard.Identity != strict.Identity {
+		t.Errorf("identity = %q, want %q", satscard.Identity, strict.Identity)
+	}
+
+}
+
+func TestUnmarshalBinaryFailureLeavesSessionUnchanged(t *testing.T) {
+
+	// A check challenge with a malformed card public key fails to verify
+	state := sessionState{
+		Version:        sessionStateVersion,
+		Identity:       "AAAAA-BBBBB-CCCCC-DDDDD-EEEEE",
+		CardPublicKey:  [33]byte{0x05, 0x01},
+		CheckChallenge: &challenge{},
+		Slots:          []slotRecord{{State: SlotUnsealed}},
+	}
+
+	data, err := cbor.Marshal(state)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	satscard := NewSatscard()
+	satscard.Identity = "FFFFF-GGGGG-HHHHH-IIIII-JJJJJ"
+	satscard.ActiveSlot = 1
+
+	if err := satscard.UnmarshalBinary(data); err == nil {
+		t.Fatal("UnmarshalBinary succeeded with an invalid card public key")
+	}
+
+	if satscard.Identity != "FFFFF-GGGGG-HHHHH-IIIII-JJJJJ" || satscard.ActiveSlot != 1 {
+		t.Errorf("session changed: identity %q, active slot %d", satscard.Identity, satscard.ActiveSlot)
+	}
+
+	if satscard.cardPublicKey != [33]byte{} || satscard.checkChallenge != nil || satscard.slots != nil {
+		t.Error("session was partially restored")
+	}
+
+}
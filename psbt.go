@@ -0,0 +1,238 @@
+package tapcards
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrNothingToSign is returned when no input of a PSBT spends from the address of the key.
+var ErrNothingToSign = errors.New("no input spends from the address of the key")
+
+// ErrRedeemScriptMismatch is returned when the redeem script of a P2SH input does not hash to the script
+// hash of the output it spends.
+var ErrRedeemScriptMismatch = errors.New("redeem script does not match the script hash it spends")
+
+// PSBT returns an unsigned PSBT of the sweep, spending from the addresses of the given slot public key.
+// The private key of the sweep is not used. Each input carries its witness UTXO, its redeem script for
+// P2SH-P2WPKH, and key origin information without a BIP 32 path, as the slot key is not derived from a
+// wallet seed. Its fingerprint is the first four bytes of the hash160 of the public key.
+//
+// P2PKH outputs are not supported, as their PSBT inputs need the whole previous transaction.
+func (sweep *Sweep) PSBT(publicKey []byte) (*psbt.Packet, error) {
+
+	for _, utxo := range sweep.UTXOs {
+		if utxo.Type == P2PKH {
+			return nil, fmt.Errorf("cannot add UTXO %v to a PSBT: %v needs the previous transaction", utxo.OutPoint, utxo.Type)
+		}
+	}
+
+	tx, prevOuts, err := sweep.unsignedTx(publicKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	packet, err := psbt.NewFromUnsignedTx(tx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	updater, err := psbt.NewUpdater(packet)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, txIn := range tx.TxIn {
+
+		prevOut := prevOuts[txIn.PreviousOutPoint]
+
+		if err := updater.AddInWitnessUtxo(prevOut, i); err != nil {
+			return nil, err
+		}
+
+		if txscript.IsPayToScriptHash(prevOut.PkScript) {
+
+			redeemScript, err := witnessPubKeyHashScript(publicKey, sweep.params())
+
+			if err != nil {
+				return nil, err
+			}
+
+			if err := updater.AddInRedeemScript(redeemScript, i); err != nil {
+				return nil, err
+			}
+
+		}
+
+		if err := updater.AddInBip32Derivation(keyFingerprint(publicKey), []uint32{}, publicKey, i); err != nil {
+			return nil, err
+		}
+
+	}
+
+	return packet, nil
+
+}
+
+// SignPSBT adds a partial signature with the private key, given as WIF, to every input of the PSBT that
+// spends from its P2WPKH or P2SH-P2WPKH address. Other inputs are left alone, so the PSBT can spend other
+// funds as well. The output spent by an input is taken from its witness UTXO, or else from the output of
+// its previous transaction. The redeem script of a P2SH input must hash to the script hash it spends.
+// It returns ErrNothingToSign if no input was signed.
+func SignPSBT(packet *psbt.Packet, privateKey string) error {
+
+	wif, err := btcutil.DecodeWIF(privateKey)
+
+	if err != nil {
+		return err
+	}
+
+	publicKey := wif.SerializePubKey()
+
+	if err := psbt.InputsReadyToSign(packet); err != nil {
+		return err
+	}
+
+	prevOuts := make(map[wire.OutPoint]*wire.TxOut, len(packet.Inputs))
+
+	for i := range packet.Inputs {
+
+		prevOut, err := inputPrevOut(packet, i)
+
+		if err != nil {
+			return err
+		}
+
+		prevOuts[packet.UnsignedTx.TxIn[i].PreviousOutPoint] = prevOut
+
+	}
+
+	sigHashes := txscript.NewTxSigHashes(packet.UnsignedTx, txscript.NewMultiPrevOutFetcher(prevOuts))
+
+	updater, err := psbt.NewUpdater(packet)
+
+	if err != nil {
+		return err
+	}
+
+	signed := 0
+
+	for i, input := range packet.Inputs {
+
+		prevOut := prevOuts[packet.UnsignedTx.TxIn[i].PreviousOutPoint]
+
+		// The script code of P2SH-P2WPKH is its redeem script, the P2WPKH output script
+		script := prevOut.PkScript
+
+		var redeemScript []byte
+
+		if txscript.IsPayToScriptHash(script) {
+
+			if len(input.RedeemScript) == 0 {
+				continue
+			}
+
+			// Signing for a redeem script the output does not commit to would sign for another script
+			if !bytes.Equal(btcutil.Hash160(input.RedeemScript), script[2:22]) {
+				return fmt.Errorf("input %d: %w", i, ErrRedeemScriptMismatch)
+			}
+
+			script = input.RedeemScript
+			redeemScript = input.RedeemScript
+
+		}
+
+		if !txscript.IsPayToWitnessPubKeyHash(script) {
+			continue
+		}
+
+		// The witness program of P2WPKH is the hash160 of the public key
+		if !bytes.Equal(script[2:], btcutil.Hash160(publicKey)) {
+			continue
+		}
+
+		hashType := input.SighashType
+
+		if hashType == 0 {
+			hashType = txscript.SigHashAll
+		}
+
+		signature, err := txscript.RawTxInWitnessSignature(packet.UnsignedTx, sigHashes, i, prevOut.Value, script, hashType, wif.PrivKey)
+
+		if err != nil {
+			return err
+		}
+
+		// Passing the redeem script lets an input with only its previous transaction be turned into a
+		// witness input, as BIP 174 expects of SegWit inputs
+		if _, err := updater.Sign(i, signature, publicKey, redeemScript, nil); err != nil {
+			return err
+		}
+
+		signed++
+
+	}
+
+	if signed == 0 {
+		return ErrNothingToSign
+	}
+
+	return nil
+
+}
+
+// FinalizePSBT finalizes every input of a fully signed PSBT and extracts the transaction, ready to be broadcast.
+func FinalizePSBT(packet *psbt.Packet) (*wire.MsgTx, error) {
+
+	if err := psbt.MaybeFinalizeAll(packet); err != nil {
+		return nil, err
+	}
+
+	return psbt.Extract(packet)
+
+}
+
+// inputPrevOut returns the output spent by an input of the PSBT, from its witness UTXO or from the
+// output of its previous transaction.
+func inputPrevOut(packet *psbt.Packet, i int) (*wire.TxOut, error) {
+
+	input := packet.Inputs[i]
+
+	if input.WitnessUtxo != nil {
+		return input.WitnessUtxo, nil
+	}
+
+	outPoint := packet.UnsignedTx.TxIn[i].PreviousOutPoint
+
+	if input.NonWitnessUtxo == nil {
+		return nil, fmt.Errorf("input %d spending %v has no UTXO", i, outPoint)
+	}
+
+	if input.NonWitnessUtxo.TxHash() != outPoint.Hash {
+		return nil, fmt.Errorf("previous transaction of input %d does not match %v", i, outPoint)
+	}
+
+	if int(outPoint.Index) >= len(input.NonWitnessUtxo.TxOut) {
+		return nil, fmt.Errorf("previous transaction of input %d has no output %d", i, outPoint.Index)
+	}
+
+	return input.NonWitnessUtxo.TxOut[outPoint.Index], nil
+
+}
+
+// keyFingerprint returns the fingerprint used as the key origin of a slot key, the first four bytes of
+// the hash160 of the public key, as serialized by the PSBT.
+func keyFingerprint(publicKey []byte) uint32 {
+
+	return binary.LittleEndian.Uint32(btcutil.Hash160(publicKey)[:4])
+
+}
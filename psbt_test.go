@@ -0,0 +1,250 @@
+package tapcards
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestSweepPSBT(t *testing.T) {
+
+	privateKey, wif := testKey(t, "slot")
+	publicKey := privateKey.PubKey().SerializeCompressed()
+
+	sweep := &Sweep{
+		UTXOs:       []UTXO{{OutPoint: testOutPoint(1), Value: 100000}, {OutPoint: testOutPoint(2), Value: 50000, Type: P2SHP2WPKH}},
+		Destination: testAddress(t, "destination", P2WPKH),
+		FeeRate:     3,
+	}
+
+	packet, err := sweep.PSBT(publicKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SignPSBT(packet, wif); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := FinalizePSBT(packet)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executeInputs(t, tx, prevOutsOf(t, sweep, publicKey))
+
+	sweep.UTXOs = append(sweep.UTXOs, UTXO{OutPoint: testOutPoint(3), Value: 50000, Type: P2PKH})
+
+	if _, err := sweep.PSBT(publicKey); err == nil {
+		t.Error("PSBT spending P2PKH created")
+	}
+
+}
+
+// TestSignPSBTMixedInputs signs a PSBT whose inputs carry a witness UTXO, only the previous transaction,
+// or belong to another key.
+func TestSignPSBTMixedInputs(t *testing.T) {
+
+	privateKey, wif := testKey(t, "slot")
+	publicKey := privateKey.PubKey().SerializeCompressed()
+
+	otherPrivateKey, otherWIF := testKey(t, "other")
+	otherPublicKey := otherPrivateKey.PubKey().SerializeCompressed()
+
+	script := func(scriptType ScriptType, publicKey []byte) []byte {
+
+		script, err := outputScript(scriptType, publicKey, &chaincfg.MainNetParams)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return script
+
+	}
+
+	// The previous transaction of the inputs that only carry it, paying to the slot key in output 1
+	// and to the other key in output 0
+	prevTx := wire.NewMsgTx(wire.TxVersion)
+	prevTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 7}, nil, nil))
+	prevTx.AddTxOut(wire.NewTxOut(40000, script(P2WPKH, otherPublicKey)))
+	prevTx.AddTxOut(wire.NewTxOut(60000, script(P2SHP2WPKH, publicKey)))
+
+	prevOuts := map[wire.OutPoint]*wire.TxOut{
+		testOutPoint(1):                   wire.NewTxOut(100000, script(P2WPKH, publicKey)),
+		{Hash: prevTx.TxHash(), Index: 1}: prevTx.TxOut[1],
+		{Hash: prevTx.TxHash(), Index: 0}: prevTx.TxOut[0],
+	}
+
+	witnessOutPoint := testOutPoint(1)
+
+	outPoints := []*wire.OutPoint{&witnessOutPoint, {Hash: prevTx.TxHash(), Index: 1}, {Hash: prevTx.TxHash(), Index: 0}}
+
+	packet, err := psbt.New(outPoints, []*wire.TxOut{wire.NewTxOut(199000, script(P2WPKH, otherPublicKey))}, wire.TxVersion, 0, []uint32{wire.MaxTxInSequenceNum, wire.MaxTxInSequenceNum, wire.MaxTxInSequenceNum})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updater, err := psbt.NewUpdater(packet)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := updater.AddInWitnessUtxo(prevOuts[testOutPoint(1)], 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range []int{1, 2} {
+		if err := updater.AddInNonWitnessUtxo(prevTx, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	redeemScript, err := witnessPubKeyHashScript(publicKey, &chaincfg.MainNetParams)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := updater.AddInRedeemScript(redeemScript, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SignPSBT(packet, wif); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []int{1, 1, 0} {
+		if got := len(packet.Inputs[i].PartialSigs); got != want {
+			t.Errorf("input %d has %d signatures, want %d", i, got, want)
+		}
+	}
+
+	if _, err := FinalizePSBT(packet); err == nil {
+		t.Error("PSBT finalized with an unsigned input")
+	}
+
+	if err := SignPSBT(packet, otherWIF); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := FinalizePSBT(packet)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executeInputs(t, tx, prevOuts)
+
+	_, unrelatedWIF := testKey(t, "unrelated")
+
+	if err := SignPSBT(packet, unrelatedWIF); !errors.Is(err, ErrNothingToSign) {
+		t.Errorf("err = %v, want %v", err, ErrNothingToSign)
+	}
+
+}
+
+func TestSignPSBTMismatchedPreviousTransaction(t *testing.T) {
+
+	_, wif := testKey(t, "slot")
+
+	prevTx := wire.NewMsgTx(wire.TxVersion)
+	prevTx.AddTxOut(wire.NewTxOut(40000, []byte{txscript.OP_TRUE}))
+
+	// The input spends output 3, which the previous transaction does not have
+	packet, err := psbt.New([]*wire.OutPoint{{Hash: prevTx.TxHash(), Index: 3}}, []*wire.TxOut{wire.NewTxOut(1000, []byte{txscript.OP_TRUE})}, wire.TxVersion, 0, []uint32{wire.MaxTxInSequenceNum})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet.Inputs[0].NonWitnessUtxo = prevTx
+
+	if err := SignPSBT(packet, wif); err == nil {
+		t.Error("PSBT signed with a missing previous output")
+	}
+
+}
+
+func TestSignPSBTRedeemScript(t *testing.T) {
+
+	privateKey, wif := testKey(t, "slot")
+	publicKey := privateKey.PubKey().SerializeCompressed()
+
+	otherPrivateKey, _ := testKey(t, "other")
+	otherPublicKey := otherPrivateKey.PubKey().SerializeCompressed()
+
+	witnessScript := func(publicKey []byte) []byte {
+
+		script, err := witnessPubKeyHashScript(publicKey, &chaincfg.MainNetParams)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return script
+
+	}
+
+	scriptHash := func(redeemScript []byte) []byte {
+
+		script, err := txscript.NewScriptBuilder().AddOp(txscript.OP_HASH160).AddData(btcutil.Hash160(redeemScript)).AddOp(txscript.OP_EQUAL).Script()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return script
+
+	}
+
+	tests := []struct {
+		name string
+		// pkScript is the output script spent, and redeemScript the redeem script of the input
+		pkScript     []byte
+		redeemScript []byte
+		// err is nil if the input is signed
+		err error
+	}{
+		{"slot key", scriptHash(witnessScript(publicKey)), witnessScript(publicKey), nil},
+		{"script hash of another script", scriptHash(witnessScript(otherPublicKey)), witnessScript(publicKey), ErrRedeemScriptMismatch},
+		{"redeem script of another key", scriptHash(witnessScript(otherPublicKey)), witnessScript(otherPublicKey), ErrNothingToSign},
+		{"redeem script not P2WPKH", scriptHash([]byte{txscript.OP_TRUE}), []byte{txscript.OP_TRUE}, ErrNothingToSign},
+		{"no redeem script", scriptHash(witnessScript(publicKey)), nil, ErrNothingToSign},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			outPoint := testOutPoint(1)
+
+			packet, err := psbt.New([]*wire.OutPoint{&outPoint}, []*wire.TxOut{wire.NewTxOut(99000, witnessScript(otherPublicKey))}, wire.TxVersion, 0, []uint32{wire.MaxTxInSequenceNum})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			packet.Inputs[0].WitnessUtxo = wire.NewTxOut(100000, test.pkScript)
+			packet.Inputs[0].RedeemScript = test.redeemScript
+
+			if err := SignPSBT(packet, wif); !errors.Is(err, test.err) {
+				t.Fatalf("err = %v, want %v", err, test.err)
+			}
+
+			if signed := len(packet.Inputs[0].PartialSigs) > 0; signed != (test.err == nil) {
+				t.Errorf("input signed: %v", signed)
+			}
+
+		})
+	}
+
+}
@@ -3,8 +3,10 @@ package tapcards
 import "log/slog"
 
 // queue is a basic FIFO queue based on a slice of interface{}.
+// It counts the elements dequeued since it was last empty, to report progress through a pipeline.
 type queue struct {
 	elements []interface{}
+	dequeued int
 }
 
 // enqueue adds an element to the end of the queue.
@@ -24,6 +26,7 @@ func (q *queue) dequeue() interface{} {
 
 	element := q.elements[0]
 	q.elements = q.elements[1:]
+	q.dequeued++
 
 	slog.Debug("Dequeue", "Command", element)
 	return element
@@ -45,3 +48,30 @@ func (q *queue) peek() interface{} {
 func (q *queue) size() int {
 	return len(q.elements)
 }
+
+// push adds an element to the start of the queue.
+// It logs the pushed element using slog.Debug.
+func (q *queue) push(element interface{}) {
+	slog.Debug("Push", "Command", element)
+	q.elements = append([]interface{}{element}, q.elements...)
+}
+
+// reset removes all elements from the queue.
+// It logs the removed elements using slog.Debug.
+func (q *queue) reset() {
+	if len(q.elements) > 0 {
+		slog.Debug("Reset", "Commands", q.elements)
+	}
+	q.elements = nil
+	q.dequeued = 0
+}
+
+// step returns the position of the first element in the pipeline, counting from 1.
+func (q *queue) step() int {
+	return q.dequeued + 1
+}
+
+// total returns the number of elements in the pipeline, including those already dequeued.
+func (q *queue) total() int {
+	return q.dequeued + len(q.elements)
+}
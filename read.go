@@ -1,19 +1,17 @@
 package tapcards
 
 import (
-	"crypto/sha256"
 	"errors"
 	"fmt"
 	"log/slog"
-
-	"github.com/btcsuite/btcd/btcec/v2"
-	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
 )
 
 func (satscard *Satscard) ReadRequest() ([]byte, error) {
 
 	slog.Debug("Request read")
 
+	satscard.startPipeline()
+
 	if satscard.currentCardNonce == [16]byte{} {
 
 		satscard.queue.enqueue("status")
@@ -53,46 +51,52 @@ func (satscard *Satscard) parseReadData(readData readData) error {
 	slog.Debug("READ", "Signature", fmt.Sprintf("%x", readData.Signature))
 	slog.Debug("READ", "PublicKey", fmt.Sprintf("%x", readData.PublicKey))
 
-	// Verify public key with signature
+	if err := satscard.rememberCardNonce(readData.CardNonce); err != nil {
+		return err
+	}
 
-	message := append([]byte(openDime), satscard.currentCardNonce[:]...)
-	message = append(message, satscard.appNonce[:]...)
-	message = append(message, []byte{byte(satscard.ActiveSlot)}...)
+	satscard.readChallenge = &signedChallenge{
+		cardNonce: satscard.currentCardNonce,
+		appNonce:  satscard.appNonce,
+		signature: readData.Signature,
+	}
+	satscard.readSlot = satscard.ActiveSlot
+	satscard.readPublicKey = readData.PublicKey
 
-	messageDigest := sha256.Sum256([]byte(message))
+	// Verify public key with signature
 
-	r := new(btcec.ModNScalar)
-	r.SetByteSlice(readData.Signature[0:32])
+	if !verifyReadSignature(readData.PublicKey, satscard.readSlot, *satscard.readChallenge) {
+		return errors.New("invalid signature read")
+	}
 
-	s := new(btcec.ModNScalar)
-	s.SetByteSlice(readData.Signature[32:])
+	satscard.currentCardNonce = readData.CardNonce
 
-	signature := ecdsa.NewSignature(r, s)
+	paymentAddress, err := paymentAddress(readData.PublicKey)
 
-	publicKey, err := btcec.ParsePubKey(readData.PublicKey[:])
 	if err != nil {
 		return err
 	}
 
-	verified := signature.Verify(messageDigest[:], publicKey)
+	// Compare with the address reported by status, as a cheap extra tamper check
+	if satscard.ActiveSlotTruncatedPaymentAddress != "" && !matchesTruncatedAddress(paymentAddress, satscard.ActiveSlotTruncatedPaymentAddress) {
+
+		return &AddressMismatchError{
+			TruncatedAddress: satscard.ActiveSlotTruncatedPaymentAddress,
+			DerivedAddress:   paymentAddress,
+		}
 
-	if !verified {
-		return errors.New("invalid signature read")
 	}
 
 	// Save the current slot public key
 	satscard.activeSlotPublicKey = readData.PublicKey
 
-	satscard.currentCardNonce = readData.CardNonce
-
-	paymentAddress, err := paymentAddress(readData.PublicKey)
+	satscard.ActiveSlotPaymentAddress = paymentAddress
 
-	if err != nil {
-		return err
+	if satscard.readSlot < len(satscard.slots) {
+		satscard.slots[satscard.readSlot].publicKey = readData.PublicKey
+		satscard.slots[satscard.readSlot].address = paymentAddress
 	}
 
-	satscard.ActiveSlotPaymentAddress = paymentAddress
-
 	return nil
 
 }
@@ -0,0 +1,177 @@
+package tapcards
+
+import (
+	"errors"
+	"log/slog"
+)
+
+// RecoverRequest recovers from an unseal or new that was interrupted, for example because the card
+// left the RF field before the response was received. Tap the same card again, run
+// ISOAppletSelectRequest and then RecoverRequest with the CVC.
+//
+// The card status is refreshed first. If the slot has been unsealed, its private key is fetched
+// with dump. If the command never reached the card, it is sent again.
+func (satscard *Satscard) RecoverRequest(cvc string) ([]byte, error) {
+
+	slog.Debug("Request recover")
+
+	satscard.startPipeline()
+
+	satscard.queue.enqueue("status")
+
+	satscard.enqueueAuthenticated("recover", cvc)
+
+	return satscard.nextCommand()
+
+}
+
+// recoverRequest decides, from the refreshed card status, which command recovers the interrupted one.
+func (satscard *Satscard) recoverRequest() ([]byte, error) {
+
+	satscard.queue.dequeue()
+
+	if satscard.newPending {
+		return satscard.recoverNewRequest()
+	}
+
+	slot := satscard.ActiveSlot
+
+	if satscard.unsealPending {
+		slot = satscard.unsealSlot
+	}
+
+	state := satscard.SlotState(slot)
+
+	slog.Debug("RECOVER", "Slot", slot, "State", state, "UnsealPending", satscard.unsealPending)
+
+	switch {
+	case state == SlotUnsealed:
+
+		satscard.dumpSlot = slot
+		satscard.queue.push("dump")
+
+		return satscard.dumpRequest()
+
+	case state == SlotSealed && satscard.unsealPending && slot == satscard.ActiveSlot:
+
+		satscard.queue.push("unseal")
+
+		return satscard.unsealRequest()
+
+	default:
+
+		satscard.cvc = ""
+
+		return nil, &SlotStateError{Command: "recover", Slot: slot, State: state}
+
+	}
+
+}
+
+// recoverNewRequest completes an interrupted new command. If the card has moved on to the next
+// slot the command took effect, otherwise it is sent again.
+func (satscard *Satscard) recoverNewRequest() ([]byte, error) {
+
+	slog.Debug("RECOVER", "NewSlot", satscard.newSlot, "ActiveSlot", satscard.ActiveSlot)
+
+	if satscard.ActiveSlot > satscard.newSlot {
+
+		satscard.newPending = false
+
+		satscard.setSlotChainCode(satscard.ActiveSlot, satscard.newChainCode)
+		satscard.newChainCode = nil
+
+		return satscard.buildNextCommand()
+
+	}
+
+	satscard.queue.push("new")
+
+	return satscard.newRequest()
+
+}
+
+// idempotentCommands are the commands that can be sent again without advancing the card.
+var idempotentCommands = map[interface{}]bool{
+	"select": true,
+	"status": true,
+	"read":   true,
+	"certs":  true,
+	"check":  true,
+	"wait":   true,
+	"dump":   true,
+}
+
+// retryRequest builds the request to send after the exchange of the command at the head of the
+// queue failed, for example because the card left the RF field. The card may or may not have
+// executed the command, so its nonce is refreshed with status first.
+//
+// Idempotent commands are simply sent again. The outcome of unseal and new is probed instead,
+// as done by RecoverRequest, and the second return value reports that a probe was needed.
+func (satscard *Satscard) retryRequest() ([]byte, bool, error) {
+
+	command := satscard.queue.peek()
+
+	if command == nil {
+		return nil, false, errors.New("nothing to retry")
+	}
+
+	slog.Debug("RETRY", "Command", command)
+
+	probe := !idempotentCommands[command]
+
+	// A partial response is useless once the command is sent again
+	satscard.responseChain = nil
+
+	if probe {
+		satscard.queue.dequeue()
+		satscard.queue.push("recover")
+	}
+
+	// The applet has to be selected before status can be sent
+	if command != "status" && command != "select" {
+		satscard.queue.push("status")
+	}
+
+	request, err := satscard.nextCommand()
+
+	return request, probe, err
+
+}
+
+// Abort drops any commands still queued for the card, together with the CVC and session key.
+// The next request starts a new pipeline. An interrupted unseal is remembered for RecoverRequest.
+func (satscard *Satscard) Abort() {
+
+	satscard.queue.reset()
+
+	satscard.cvc = ""
+	satscard.sessionKey = [32]byte{}
+
+	satscard.lastRequest = nil
+	satscard.responseChain = nil
+
+}
+
+// Reset aborts any queued commands and forgets the card nonce, so the next request starts by
+// refreshing the card status. Use it when the card has left the RF field mid-operation.
+func (satscard *Satscard) Reset() {
+
+	satscard.Abort()
+
+	satscard.currentCardNonce = [16]byte{}
+
+}
+
+// startPipeline makes sure a new request does not build on top of a pipeline that never finished.
+func (satscard *Satscard) startPipeline() {
+
+	if satscard.queue.size() > 0 {
+
+		slog.Debug("Previous pipeline did not finish")
+
+		satscard.Reset()
+
+	}
+
+}
@@ -0,0 +1,249 @@
+package tapcards
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// slotWIF returns the private key of a slot of the simulated card as WIF.
+func slotWIF(t *testing.T, card *simulatedCard, slot int) string {
+
+	wif, err := btcutil.NewWIF(card.slots[slot].privateKey, &chaincfg.MainNetParams, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return wif.String()
+
+}
+
+// tap selects the applet, as done whenever the card enters the RF field.
+func tap(t *testing.T, card *simulatedCard, satscard *Satscard) {
+
+	if err := card.run(satscard, func() ([]byte, error) { return satscard.ISOAppletSelectRequest() }); err != nil {
+		t.Fatal(err)
+	}
+
+}
+
+// checkPipelineDone fails the test if anything is left of the last pipeline.
+func checkPipelineDone(t *testing.T, satscard *Satscard) {
+
+	t.Helper()
+
+	if satscard.queue.size() != 0 || satscard.cvc != "" {
+		t.Errorf("queue %v and CVC %q left behind", satscard.queue.elements, satscard.cvc)
+	}
+
+}
+
+func TestRecoverUnseal(t *testing.T) {
+
+	tests := []struct {
+		name string
+		drop func(card *simulatedCard)
+		// want are the commands sent once the card is tapped again
+		want []string
+	}{
+		{"response lost", func(card *simulatedCard) { card.dropResponse = "unseal" }, []string{"select", "status", "dump"}},
+		{"command lost", func(card *simulatedCard) { card.dropCommand = "unseal" }, []string{"select", "status", "unseal"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			card := newSimulatedCard(t)
+			satscard := card.satscard()
+
+			tap(t, card, satscard)
+
+			test.drop(card)
+
+			if err := card.run(satscard, func() ([]byte, error) { return satscard.UnsealRequest(card.cvc) }); !errors.Is(err, errFieldLost) {
+				t.Fatalf("err = %v, want %v", err, errFieldLost)
+			}
+
+			// The app gives up on the exchange
+			satscard.Reset()
+
+			checkPipelineDone(t, satscard)
+
+			if satscard.ActiveSlotPrivateKey != "" || !satscard.unsealPending {
+				t.Fatalf("private key %q, unseal pending %v", satscard.ActiveSlotPrivateKey, satscard.unsealPending)
+			}
+
+			card.commands = nil
+
+			tap(t, card, satscard)
+
+			if err := card.run(satscard, func() ([]byte, error) { return satscard.RecoverRequest(card.cvc) }); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(card.commands, test.want) {
+				t.Errorf("commands = %v, want %v", card.commands, test.want)
+			}
+
+			if want := slotWIF(t, card, 0); satscard.ActiveSlotPrivateKey != want {
+				t.Errorf("private key = %q, want %q", satscard.ActiveSlotPrivateKey, want)
+			}
+
+			if satscard.ActiveSlotState() != SlotUnsealed || satscard.unsealPending {
+				t.Errorf("slot 0 is %v, unseal pending %v", satscard.ActiveSlotState(), satscard.unsealPending)
+			}
+
+			checkPipelineDone(t, satscard)
+
+		})
+	}
+
+}
+
+func TestRecoverNew(t *testing.T) {
+
+	tests := []struct {
+		name string
+		drop func(card *simulatedCard)
+		want []string
+	}{
+		{"response lost", func(card *simulatedCard) { card.dropResponse = "new" }, []string{"select", "status"}},
+		{"command lost", func(card *simulatedCard) { card.dropCommand = "new" }, []string{"select", "status", "new"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			card := newSimulatedCard(t)
+			card.slots[0].state = SlotUnsealed
+
+			satscard := card.satscard()
+
+			tap(t, card, satscard)
+
+			test.drop(card)
+
+			if err := card.run(satscard, func() ([]byte, error) { return satscard.NewRequest(card.cvc) }); !errors.Is(err, errFieldLost) {
+				t.Fatalf("err = %v, want %v", err, errFieldLost)
+			}
+
+			satscard.Reset()
+
+			if !satscard.newPending {
+				t.Fatal("interrupted new not remembered")
+			}
+
+			card.commands = nil
+
+			tap(t, card, satscard)
+
+			if err := card.run(satscard, func() ([]byte, error) { return satscard.RecoverRequest(card.cvc) }); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(card.commands, test.want) {
+				t.Errorf("commands = %v, want %v", card.commands, test.want)
+			}
+
+			// The new slot was set up exactly once
+			if card.activeSlot != 1 || satscard.ActiveSlot != 1 || satscard.ActiveSlotState() != SlotSealed || satscard.newPending {
+				t.Errorf("card on slot %d, session on slot %d which is %v, new pending %v", card.activeSlot, satscard.ActiveSlot, satscard.ActiveSlotState(), satscard.newPending)
+			}
+
+			checkPipelineDone(t, satscard)
+
+		})
+	}
+
+}
+
+func TestRecoverNothingPending(t *testing.T) {
+
+	card := newSimulatedCard(t)
+	satscard := card.satscard()
+
+	tap(t, card, satscard)
+
+	var slotStateError *SlotStateError
+
+	if err := card.run(satscard, func() ([]byte, error) { return satscard.RecoverRequest(card.cvc) }); !errors.As(err, &slotStateError) {
+		t.Fatalf("err = %v, want a SlotStateError", err)
+	}
+
+	if slotStateError.State != SlotSealed {
+		t.Errorf("state = %v, want sealed", slotStateError.State)
+	}
+
+	// Nothing is sent with the CVC, and the card stays sealed
+	for _, command := range card.commands {
+		if command == "unseal" || command == "dump" || command == "new" {
+			t.Errorf("%s sent", command)
+		}
+	}
+
+	checkPipelineDone(t, satscard)
+
+}
+
+func TestAbortAndReset(t *testing.T) {
+
+	card := newSimulatedCard(t)
+	satscard := card.satscard()
+
+	tap(t, card, satscard)
+
+	if err := card.run(satscard, satscard.CertsRequest); err != nil {
+		t.Fatal(err)
+	}
+
+	cardNonce := satscard.currentCardNonce
+
+	// The card has been verified, so unseal is the first command and the session key is set
+	if _, err := satscard.UnsealRequest(card.cvc); err != nil {
+		t.Fatal(err)
+	}
+
+	if satscard.queue.size() == 0 || satscard.sessionKey == [32]byte{} {
+		t.Fatal("unseal not queued")
+	}
+
+	satscard.Abort()
+
+	checkPipelineDone(t, satscard)
+
+	if satscard.sessionKey != [32]byte{} || satscard.lastRequest != nil {
+		t.Error("session key or last request kept after Abort")
+	}
+
+	if satscard.currentCardNonce != cardNonce {
+		t.Error("card nonce forgotten by Abort")
+	}
+
+	if _, err := satscard.UnsealRequest(card.cvc); err != nil {
+		t.Fatal(err)
+	}
+
+	satscard.Reset()
+
+	checkPipelineDone(t, satscard)
+
+	if satscard.sessionKey != [32]byte{} || satscard.currentCardNonce != [16]byte{} {
+		t.Error("session key or card nonce kept after Reset")
+	}
+
+	// The next request starts a fresh pipeline with status
+	card.commands = nil
+
+	if err := card.run(satscard, satscard.ReadRequest); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"status", "read"}; !reflect.DeepEqual(card.commands, want) {
+		t.Errorf("commands = %v, want %v", card.commands, want)
+	}
+
+}
@@ -0,0 +1,205 @@
+package tapcards
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CardRegistry remembers the factory root and certificate chain of the cards verified before,
+// so a card that presents a known identity with a different chain is rejected (trust on first use).
+//
+// The public key is not remembered, as the identity is derived from it and a card can only
+// present a known identity with the same public key.
+type CardRegistry interface {
+	// Lookup returns the card remembered for the identity, and whether there is one.
+	Lookup(identity string) (*RegisteredCard, bool, error)
+	// Remember records a card verified for the first time.
+	Remember(identity string, card RegisteredCard) error
+}
+
+// RegisteredCard is what a CardRegistry remembers about a card.
+type RegisteredCard struct {
+	// FactoryRoot is the name of the trusted factory root the certificate chain led to.
+	FactoryRoot string
+	// CertificateChain is the certificate chain returned by certs.
+	CertificateChain [][]byte
+}
+
+// registryEntry is a card remembered by a FileRegistry.
+type registryEntry struct {
+	FactoryRoot      string    `json:"factory_root"`
+	CertificateChain []string  `json:"cert_chain"`
+	FirstSeen        time.Time `json:"first_seen"`
+}
+
+// FileRegistry is a CardRegistry stored as a JSON file on disk.
+// It is safe for concurrent use within a process.
+type FileRegistry struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// NewFileRegistry returns a registry stored in the file at path.
+// The file is created when the first card is remembered.
+func NewFileRegistry(path string) *FileRegistry {
+	return &FileRegistry{path: path}
+}
+
+// Lookup returns the card remembered for the identity, and whether there is one.
+func (registry *FileRegistry) Lookup(identity string) (*RegisteredCard, bool, error) {
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	entries, err := registry.load()
+	if err != nil {
+		return nil, false, err
+	}
+
+	entry, found := entries[identity]
+	if !found {
+		return nil, false, nil
+	}
+
+	card := RegisteredCard{FactoryRoot: entry.FactoryRoot}
+
+	for _, certificate := range entry.CertificateChain {
+
+		certificateBytes, err := hex.DecodeString(certificate)
+		if err != nil {
+			return nil, false, err
+		}
+
+		card.CertificateChain = append(card.CertificateChain, certificateBytes)
+
+	}
+
+	return &card, true, nil
+
+}
+
+// Remember records a card verified for the first time.
+// A card that is already known keeps its original entry.
+func (registry *FileRegistry) Remember(identity string, card RegisteredCard) error {
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	entries, err := registry.load()
+	if err != nil {
+		return err
+	}
+
+	if _, found := entries[identity]; found {
+		return nil
+	}
+
+	entry := registryEntry{
+		FactoryRoot: card.FactoryRoot,
+		FirstSeen:   time.Now().UTC(),
+	}
+
+	for _, certificate := range card.CertificateChain {
+		entry.CertificateChain = append(entry.CertificateChain, hex.EncodeToString(certificate))
+	}
+
+	entries[identity] = entry
+
+	return registry.save(entries)
+
+}
+
+// load reads the registry file. A missing file is an empty registry.
+func (registry *FileRegistry) load() (map[string]registryEntry, error) {
+
+	entries := make(map[string]registryEntry)
+
+	data, err := os.ReadFile(registry.path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+
+}
+
+// save writes the registry file, replacing it atomically.
+func (registry *FileRegistry) save(entries map[string]registryEntry) error {
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(registry.path), filepath.Base(registry.path)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), registry.path)
+
+}
+
+// checkRegistry compares the verified card with the one remembered under the same identity,
+// remembering it if it has not been verified before.
+func (satscard *Satscard) checkRegistry(factoryRoot string) error {
+
+	if satscard.Registry == nil {
+		return nil
+	}
+
+	card := RegisteredCard{FactoryRoot: factoryRoot}
+
+	for _, certificate := range satscard.certificateChain {
+		card.CertificateChain = append(card.CertificateChain, append([]byte(nil), certificate[:]...))
+	}
+
+	registered, found, err := satscard.Registry.Lookup(satscard.Identity)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return satscard.Registry.Remember(satscard.Identity, card)
+	}
+
+	if registered.FactoryRoot != card.FactoryRoot || len(registered.CertificateChain) != len(card.CertificateChain) {
+		return ErrRegisteredCardMismatch
+	}
+
+	for i, certificate := range registered.CertificateChain {
+		if !bytes.Equal(certificate, card.CertificateChain[i]) {
+			return ErrRegisteredCardMismatch
+		}
+	}
+
+	return nil
+
+}
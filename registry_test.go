@@ -0,0 +1,176 @@
+package tapcards
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileRegistry(t *testing.T) {
+
+	directory := t.TempDir()
+	path := filepath.Join(directory, "cards.json")
+
+	registry := NewFileRegistry(path)
+
+	// First use
+	if _, found, err := registry.Lookup("AAAAA-BBBBB-CCCCC-DDDDD-EEEEE"); found || err != nil {
+		t.Fatalf("Lookup in a missing file = %v, %v", found, err)
+	}
+
+	card := RegisteredCard{FactoryRoot: ProductionRoot, CertificateChain: [][]byte{{0x01, 0x02}, {0x03}}}
+
+	if err := registry.Remember("AAAAA-BBBBB-CCCCC-DDDDD-EEEEE", card); err != nil {
+		t.Fatal(err)
+	}
+
+	// A known identity keeps its original entry
+	if err := registry.Remember("AAAAA-BBBBB-CCCCC-DDDDD-EEEEE", RegisteredCard{FactoryRoot: "other"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := registry.Remember("FFFFF-GGGGG-HHHHH-IIIII-JJJJJ", RegisteredCard{FactoryRoot: EmulatorRoot}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new registry on the same file sees both cards
+	registered, found, err := NewFileRegistry(path).Lookup("AAAAA-BBBBB-CCCCC-DDDDD-EEEEE")
+
+	if err != nil || !found {
+		t.Fatalf("Lookup = %v, %v", found, err)
+	}
+
+	if !reflect.DeepEqual(*registered, card) {
+		t.Errorf("registered card = %+v, want %+v", *registered, card)
+	}
+
+	if registered, _, _ := registry.Lookup("FFFFF-GGGGG-HHHHH-IIIII-JJJJJ"); registered == nil || registered.FactoryRoot != EmulatorRoot {
+		t.Errorf("second card = %+v", registered)
+	}
+
+	// The file is replaced by renaming a complete temporary file, which is not left behind
+	entries, err := os.ReadDir(directory)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Name() != "cards.json" {
+		t.Errorf("directory holds %v, want only cards.json", entries)
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !json.Valid(data) {
+		t.Errorf("registry file is not valid JSON: %s", data)
+	}
+
+}
+
+func TestFileRegistryCorrupt(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "cards.json")
+
+	corrupt := []byte(`{"AAAAA-BBBBB-CCCCC-DDDDD-EEEEE": {"factory_root": "prod`)
+
+	if err := os.WriteFile(path, corrupt, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := NewFileRegistry(path)
+
+	if _, _, err := registry.Lookup("AAAAA-BBBBB-CCCCC-DDDDD-EEEEE"); err == nil {
+		t.Error("corrupt registry read")
+	}
+
+	if err := registry.Remember("FFFFF-GGGGG-HHHHH-IIIII-JJJJJ", RegisteredCard{FactoryRoot: ProductionRoot}); err == nil {
+		t.Error("card remembered in a corrupt registry")
+	}
+
+	// The file is left alone rather than overwritten with the new card only
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, corrupt) {
+		t.Errorf("corrupt registry file replaced with %s", data)
+	}
+
+}
+
+func TestSatscardRegistry(t *testing.T) {
+
+	registry := NewFileRegistry(filepath.Join(t.TempDir(), "cards.json"))
+
+	card := newSimulatedCard(t)
+
+	verify := func(card *simulatedCard) (*Satscard, *recordingObserver, error) {
+
+		observer := &recordingObserver{}
+
+		satscard := card.satscard()
+		satscard.Registry = registry
+		satscard.Observer = observer
+
+		err := card.run(satscard, satscard.CertsRequest)
+
+		return satscard, observer, err
+
+	}
+
+	// The card is remembered on first use, and recognised afterwards
+	for i := 0; i < 2; i++ {
+		if satscard, _, err := verify(card); err != nil || !satscard.verified {
+			t.Fatalf("verification %d: %v", i+1, err)
+		}
+	}
+
+	registered, found, err := registry.Lookup(card.satscardIdentity())
+
+	if err != nil || !found || registered.FactoryRoot != testRoot || len(registered.CertificateChain) != 2 {
+		t.Fatalf("registered card = %+v, %v, %v", registered, found, err)
+	}
+
+	// The same card key certified through another batch key still leads to the trusted root,
+	// but does not match the chain remembered for the identity
+	swapped := newSimulatedCard(t)
+	batchKey := seededKey("other batch")
+	swapped.certificateChain = [][]byte{
+		swapped.certify(batchKey, swapped.privateKey.PubKey()),
+		swapped.certify(seededKey("root"), batchKey.PubKey()),
+	}
+
+	satscard, observer, err := verify(swapped)
+
+	if !errors.Is(err, ErrRegisteredCardMismatch) {
+		t.Fatalf("err = %v, want %v", err, ErrRegisteredCardMismatch)
+	}
+
+	if satscard.verified || satscard.FactoryRoot != "" {
+		t.Error("swapped card verified")
+	}
+
+	if last := observer.events[len(observer.events)-1]; last.Type != EventVerificationFailed || !errors.Is(last.Err, ErrRegisteredCardMismatch) {
+		t.Errorf("last event = %+v, want verification failed", last)
+	}
+
+	// Another card is remembered under its own identity
+	other := newSimulatedCard(t)
+	other.privateKey = seededKey("other card")
+	other.certificateChain[0] = other.certify(seededKey("batch"), other.privateKey.PubKey())
+
+	if _, _, err := verify(other); err != nil {
+		t.Errorf("other card: %v", err)
+	}
+
+}
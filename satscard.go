@@ -1,19 +1,17 @@
 package tapcards
 
 import (
+	"bytes"
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
-
-	"github.com/fxamacker/cbor/v2"
 )
 
 const openDime = "OPENDIME"
 
-var factoryRootPublicKeyString = "03028a0e89e70d0ec0d932053a89ab1da7d9182bdc6d2f03e706ee99517d05d9e1"
-
 // Satscard is a struct that represents a Satscard.
 type Satscard struct {
 
@@ -25,8 +23,12 @@ type Satscard struct {
 	NumberOfSlots int
 	// Identity is the human readable identity of the card.
 	Identity string
-	// ActiveSlotPaymentAddress is the payment address associated with the currently active slot.
+	// ActiveSlotPaymentAddress is the full payment address associated with the currently active slot.
+	// It is derived from the slot public key returned by read.
 	ActiveSlotPaymentAddress string
+	// ActiveSlotTruncatedPaymentAddress is the abbreviated payment address reported by status,
+	// such as bc1qxxxx___yyyy. It is empty if the card did not report one.
+	ActiveSlotTruncatedPaymentAddress string
 	// Proto is the protocol version of the card.
 	Proto int
 	// Birth is the block height of the card.
@@ -37,6 +39,29 @@ type Satscard struct {
 	ActiveSlotPrivateKey string
 	// AuthDelay is the authentication delay of the card.
 	AuthDelay int
+	// FactoryRoot is the name of the trusted factory root the card's certificate chain leads to.
+	// It is empty until the certificate chain has been verified.
+	FactoryRoot string
+
+	// TrustStore holds the factory roots trusted by this session.
+	// If nil, the store returned by DefaultTrustStore is used.
+	TrustStore *TrustStore
+	// Registry, if set, remembers the cards verified before and rejects a known identity
+	// presenting a different factory root or certificate chain.
+	Registry CardRegistry
+	// Observer, if set, is notified as commands are sent and parsed, when the card is
+	// verified, and when the authentication delay changes.
+	Observer Observer
+	// Rand is the source of randomness for the nonces and ephemeral keys sent to the card.
+	// If nil, crypto/rand is used. Set it to a deterministic reader to reproduce a session byte for byte.
+	Rand io.Reader
+	// StrictDecoding rejects responses with fields the library does not know about, which is useful
+	// in tests. By default such fields are logged as protocol drift and made available through Extra.
+	StrictDecoding bool
+	// Strict requires the card's certificate chain to be verified before the CVC is used.
+	// When set, UnsealRequest and NewRequest queue certs, read and check first if the card
+	// has not been verified yet, and the CVC is never sent to an unverified card.
+	Strict bool
 
 	// Private fields
 
@@ -44,6 +69,8 @@ type Satscard struct {
 	appNonce []byte
 	// currentCardNonce is the current nonce of the card.
 	currentCardNonce [16]byte
+	// seenCardNonces holds every card nonce received during the session, to detect replayed responses.
+	seenCardNonces map[[16]byte]struct{}
 	// cardPublicKey is the public key of the card.
 	cardPublicKey [33]byte
 	// sessionKey is the session key of the card.
@@ -52,24 +79,71 @@ type Satscard struct {
 	activeSlotPublicKey [33]byte
 	// certificateChain is the certificate chain of the card.
 	certificateChain [][65]byte
+	// checkChallenge is the last challenge answered by the check command.
+	checkChallenge *signedChallenge
+	// readChallenge is the last challenge answered by the read command.
+	readChallenge *signedChallenge
+	// readSlot is the slot the last read command was answered for.
+	readSlot int
+	// readPublicKey is the slot public key returned by the last read command.
+	readPublicKey [33]byte
+	// unsealSlot is the slot the last unseal command was sent for.
+	unsealSlot int
+	// unsealPending is set while an unseal command has been sent without its response being parsed.
+	unsealPending bool
+	// newSlot is the active slot when the last new command was sent.
+	newSlot int
+	// newPending is set while a new command has been sent without its response being parsed.
+	newPending bool
+	// newChainCode is the chain code sent with the last new command, if any.
+	newChainCode []byte
+	// dumpSlot is the slot the last dump command was sent for.
+	dumpSlot int
+	// slots holds what is known about each slot on the card.
+	slots []slot
+	// selectAIDs holds the AIDs still to be tried by the applet select, starting with the current one.
+	selectAIDs [][]byte
+	// extra holds the unknown fields of the last response to each command.
+	extra map[string]map[string]interface{}
+
+	// verified is set once the certificate chain of the card has been verified against the trust store.
+	verified bool
 
 	// cvc is the Card Verification Code of the card.
 	cvc string
 
+	// lastRequest is the last command APDU returned to the caller, sent again with the right Le on 6Cxx.
+	lastRequest []byte
+	// responseChain collects the data of a response split across GET RESPONSE exchanges.
+	responseChain []byte
+
 	// queue is the queue of commands to be sent to the card.
 	queue
 }
 
+// NewSatscard returns a Satscard in strict mode, which verifies that the card is genuine
+// before sending it the CVC.
+func NewSatscard() *Satscard {
+
+	return &Satscard{Strict: true}
+
+}
+
 func (satscard *Satscard) createNonce() ([]byte, error) {
 
 	// Create nonce
 	nonce := make([]byte, 16)
-	_, err := rand.Read(nonce)
+	_, err := io.ReadFull(satscard.random(), nonce)
 
 	if err != nil {
 		return nil, err
 	}
 
+	// The protocol does not allow nonces made of a single repeated byte
+	if bytes.Count(nonce, nonce[:1]) == len(nonce) {
+		return nil, ErrWeakNonce
+	}
+
 	slog.Debug("Created nonce", "Nonce", fmt.Sprintf("%x", nonce))
 
 	satscard.appNonce = nonce
@@ -78,176 +152,167 @@ func (satscard *Satscard) createNonce() ([]byte, error) {
 
 }
 
-func (satscard *Satscard) ParseResponse(response []byte) ([]byte, error) {
+// rememberCardNonce records a card nonce received in a response.
+// It returns ErrReplayedNonce if the nonce has been received before during the session,
+// which means the response is a replay of an earlier one.
+func (satscard *Satscard) rememberCardNonce(nonce [16]byte) error {
 
-	bytes, err := apduUnwrap(response)
-
-	if err != nil {
-		return nil, err
+	if satscard.seenCardNonces == nil {
+		satscard.seenCardNonces = make(map[[16]byte]struct{})
 	}
 
-	decMode, _ := cbor.DecOptions{ExtraReturnErrors: cbor.ExtraDecErrorUnknownField}.DecMode()
+	if _, seen := satscard.seenCardNonces[nonce]; seen {
 
-	command := satscard.queue.dequeue()
+		slog.Debug("Replayed card nonce", "CardNonce", fmt.Sprintf("%x", nonce))
 
-	if command == nil {
-		return nil, fmt.Errorf("queue empty")
+		return ErrReplayedNonce
 	}
 
-	//TODO: Take a look at generics to see if we can avoid code repetition here
-	switch command {
-	case "status":
+	satscard.seenCardNonces[nonce] = struct{}{}
 
-		var v statusData
+	return nil
 
-		if err := decMode.Unmarshal(bytes, &v); err != nil {
-
-			var e errorData
-
-			if err := decMode.Unmarshal(bytes, &e); err != nil {
-
-				return nil, err
-			}
+}
 
-			return nil, fmt.Errorf("%d: %v", e.Code, e.Error)
+func (satscard *Satscard) ParseResponse(response []byte) (request []byte, err error) {
 
+	// Never leave a half-finished pipeline behind
+	defer func() {
+		if err != nil {
+			satscard.Abort()
 		}
+	}()
 
-		err = satscard.parseStatusData(v)
+	bytes, request, err := satscard.unwrapResponse(response)
 
-	case "read":
-
-		var v readData
-
-		if err := decMode.Unmarshal(bytes, &v); err != nil {
-
-			var e errorData
-
-			if err := decMode.Unmarshal(bytes, &e); err != nil {
-				return nil, err
-			}
-
-			return nil, fmt.Errorf("%d: %v", e.Code, e.Error)
+	if err != nil {
 
+		// The card may not have the applet, so try the next AID
+		if satscard.queue.peek() == "select" {
+			return satscard.selectNextAID(err)
 		}
 
-		err = satscard.parseReadData(v)
-	case "unseal":
+		return nil, err
+	}
 
-		var v unsealData
+	// The response is not complete yet, so fetch the rest before parsing it
+	if request != nil {
 
-		if err := decMode.Unmarshal(bytes, &v); err != nil {
+		slog.Debug("Response chaining", "Request", fmt.Sprintf("%x", request))
 
-			var e errorData
+		satscard.lastRequest = request
 
-			if err := decMode.Unmarshal(bytes, &e); err != nil {
-				return nil, err
-			}
+		return request, nil
+	}
 
-			return nil, fmt.Errorf("%d: %v", e.Code, e.Error)
+	command := satscard.queue.dequeue()
 
-		}
+	if command == nil {
+		return nil, fmt.Errorf("queue empty")
+	}
 
-		err = satscard.parseUnsealData(v)
+	switch command {
+	case "select":
+		err = satscard.parseSelectData(bytes)
+	case "status":
+		err = parseResponseData(satscard, "status", bytes, satscard.parseStatusData)
+	case "read":
+		err = parseResponseData(satscard, "read", bytes, satscard.parseReadData)
+	case "unseal":
+		err = parseResponseData(satscard, "unseal", bytes, satscard.parseUnsealData)
 	case "certs":
-
-		var v certsData
-
-		if err := decMode.Unmarshal(bytes, &v); err != nil {
-
-			var e errorData
-
-			if err := decMode.Unmarshal(bytes, &e); err != nil {
-				return nil, err
-			}
-
-			return nil, fmt.Errorf("%d: %v", e.Code, e.Error)
-
-		}
-
-		err = satscard.parseCertsData(v)
+		err = parseResponseData(satscard, "certs", bytes, satscard.parseCertsData)
 	case "check":
+		err = parseResponseData(satscard, "check", bytes, satscard.parseCheckData)
+	case "new":
+		err = parseResponseData(satscard, "new", bytes, satscard.parseNewData)
+	case "wait":
+		err = parseResponseData(satscard, "wait", bytes, satscard.parseWaitData)
+	case "dump":
+		err = parseResponseData(satscard, "dump", bytes, satscard.parseDumpData)
 
-		var v checkData
+	default:
 
-		if err := decMode.Unmarshal(bytes, &v); err != nil {
+		return nil, errors.New("incorrect command found in queue")
 
-			var e errorData
+	}
 
-			if err := decMode.Unmarshal(bytes, &e); err != nil {
-				return nil, err
-			}
+	var cardError *CardError
 
-			return nil, fmt.Errorf("%d: %v", e.Code, e.Error)
+	if errors.As(err, &cardError) {
 
+		// The card refused the command, so there is nothing to recover
+		switch command {
+		case "unseal":
+			satscard.unsealPending = false
+		case "new":
+			satscard.newPending = false
 		}
 
-		err = satscard.parseCheckData(v)
-	case "new":
-
-		var v newData
-
-		if err := decMode.Unmarshal(bytes, &v); err != nil {
-
-			var e errorData
-
-			if err := decMode.Unmarshal(bytes, &e); err != nil {
-				return nil, err
-			}
-
-			return nil, fmt.Errorf("%d: %v", e.Code, e.Error)
+	}
 
-		}
+	if err != nil {
+		return nil, err
 
-		err = satscard.parseNewData(v)
-	case "wait":
+	}
 
-		var v waitData
+	satscard.emit(Event{Type: EventCommandParsed, Command: command.(string), Step: satscard.queue.step() - 1})
 
-		if err := decMode.Unmarshal(bytes, &v); err != nil {
+	// Check if there are more commands to run
 
-			var e errorData
+	return satscard.nextCommand()
 
-			if err := decMode.Unmarshal(bytes, &e); err != nil {
-				return nil, err
-			}
+}
 
-			return nil, fmt.Errorf("%d: %v", e.Code, e.Error)
+func (satscard *Satscard) nextCommand() (request []byte, err error) {
 
+	// Never leave a half-finished pipeline behind
+	defer func() {
+		if err != nil {
+			satscard.Abort()
 		}
+	}()
 
-		err = satscard.parseWaitData(v)
+	request, err = satscard.buildNextCommand()
 
-	default:
+	satscard.lastRequest = request
 
-		return nil, errors.New("incorrect command found in queue")
+	if request != nil && err == nil {
 
-	}
+		command, _ := satscard.queue.peek().(string)
 
-	if err != nil {
-		return nil, err
+		satscard.emit(Event{Type: EventCommandSent, Command: command, Step: satscard.queue.step()})
 
 	}
 
-	// Check if there are more commands to run
-
-	return satscard.nextCommand()
+	return request, err
 
 }
 
-func (satscard *Satscard) nextCommand() ([]byte, error) {
+// buildNextCommand builds the request for the command at the head of the queue.
+func (satscard *Satscard) buildNextCommand() ([]byte, error) {
 
 	command := satscard.queue.peek()
 
 	if command == nil {
 
 		satscard.cvc = ""
+		satscard.queue.reset()
 
 		return nil, nil
 	}
 
+	// Refuse commands the firmware is known not to support before anything is sent
+	if command != "select" && command != "recover" {
+		if err := satscard.requireCapability(command.(string)); err != nil {
+			return nil, err
+		}
+	}
+
 	switch command {
 
+	case "select":
+		return satscard.selectRequest()
 	case "status":
 		return satscard.statusRequest()
 	case "read":
@@ -262,6 +327,10 @@ func (satscard *Satscard) nextCommand() ([]byte, error) {
 		return satscard.newRequest()
 	case "wait":
 		return satscard.waitRequest()
+	case "dump":
+		return satscard.dumpRequest()
+	case "recover":
+		return satscard.recoverRequest()
 
 	default:
 		return nil, errors.New("incorrect command")
@@ -279,9 +348,22 @@ func EnableDebugLogging() {
 	slog.SetDefault(slog.New(handler))
 }
 
-// UseEmulator is a function that sets the factory root public key string to the specific value associated with the emulator.
-func UseEmulator() {
+// random returns the source of randomness used by the session.
+func (satscard *Satscard) random() io.Reader {
+
+	if satscard.Rand != nil {
+		return satscard.Rand
+	}
+
+	return rand.Reader
+}
+
+// trustStore returns the trust store used by the session.
+func (satscard *Satscard) trustStore() *TrustStore {
 
-	factoryRootPublicKeyString = "022b6750a0c09f632df32afc5bef66568667e04b2e0f57cb8640ac5a040179442b"
+	if satscard.TrustStore != nil {
+		return satscard.TrustStore
+	}
 
+	return defaultTrustStore
 }
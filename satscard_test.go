@@ -0,0 +1,90 @@
+package tapcards
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestReplayedNonce(t *testing.T) {
+
+	card := newSimulatedCard(t)
+
+	cardPublicKey := card.privateKey.PubKey().SerializeCompressed()
+
+	status := func(cardNonce []byte) []byte {
+		return responseAPDU(t, map[string]interface{}{
+			"proto":      1,
+			"ver":        "1.0.3",
+			"slots":      []int{0, 10},
+			"pubkey":     cardPublicKey,
+			"card_nonce": cardNonce,
+		})
+	}
+
+	var satscard Satscard
+
+	if _, err := satscard.StatusRequest(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := satscard.ParseResponse(status(counting(0x10, 16))); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second status answered with the same card nonce is a replay of the first
+	if _, err := satscard.StatusRequest(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := satscard.ParseResponse(status(counting(0x10, 16))); !errors.Is(err, ErrReplayedNonce) {
+		t.Fatalf("err = %v, want %v", err, ErrReplayedNonce)
+	}
+
+	// So is a read answered with the card nonce of that status
+	if _, err := satscard.ReadRequest(); err != nil {
+		t.Fatal(err)
+	}
+
+	read := responseAPDU(t, map[string]interface{}{
+		"sig":        make([]byte, 64),
+		"pubkey":     card.slotPublicKey(0),
+		"card_nonce": counting(0x10, 16),
+	})
+
+	if _, err := satscard.ParseResponse(read); !errors.Is(err, ErrReplayedNonce) {
+		t.Fatalf("err = %v, want %v", err, ErrReplayedNonce)
+	}
+
+	// A fresh card nonce is accepted
+	if _, err := satscard.StatusRequest(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := satscard.ParseResponse(status(counting(0x20, 16))); err != nil {
+		t.Errorf("fresh card nonce: %v", err)
+	}
+
+}
+
+func TestWeakNonce(t *testing.T) {
+
+	satscard := Satscard{Rand: bytes.NewReader(bytes.Repeat([]byte{0x07}, 16))}
+	satscard.currentCardNonce = [16]byte{1}
+
+	if _, err := satscard.ReadRequest(); !errors.Is(err, ErrWeakNonce) {
+		t.Fatalf("err = %v, want %v", err, ErrWeakNonce)
+	}
+
+	if satscard.appNonce != nil || satscard.queue.size() != 0 {
+		t.Error("weak nonce kept or pipeline left behind")
+	}
+
+	// A nonce with a single differing byte is fine
+	satscard.Rand = bytes.NewReader(append(bytes.Repeat([]byte{0x07}, 15), 0x08))
+
+	if _, err := satscard.ReadRequest(); err != nil {
+		t.Errorf("nonce rejected: %v", err)
+	}
+
+}
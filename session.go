@@ -0,0 +1,278 @@
+package tapcards
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Transport exchanges APDUs with a card, for example over NFC or a USB reader.
+type Transport interface {
+	// Transmit sends a command APDU to the card and returns the response APDU.
+	// It should return early with the context's error when the context is done.
+	Transmit(ctx context.Context, command []byte) ([]byte, error)
+}
+
+// Session drives the commands of a Satscard over a Transport, respecting cancellation and deadlines.
+// When an operation is cancelled or fails to reach the card, the pipeline is reset and the CVC and
+// session key are cleared.
+type Session struct {
+	// Satscard holds the state of the card.
+	Satscard *Satscard
+	// Transport exchanges APDUs with the card.
+	Transport Transport
+	// APDUTimeout limits each exchange with the card. Zero means no limit.
+	APDUTimeout time.Duration
+	// Timeout limits each operation as a whole. Zero means no limit besides the context.
+	Timeout time.Duration
+	// Retry is the policy for exchanges that fail to reach the card. The zero value does not retry.
+	Retry RetryPolicy
+
+	// busy holds a token while the transport is in use, including by an exchange that timed out
+	// but has not returned yet, so APDUs are never sent concurrently.
+	busy     chan struct{}
+	busyOnce sync.Once
+}
+
+// RetryPolicy describes how exchanges that fail to reach the card are retried.
+// Only read, status, certs, check, wait and dump are sent again. For unseal and new, which
+// would advance the card, the card status is probed instead to find out whether the command
+// took effect, and the command is only sent again if it did not.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries per operation. Zero disables retries.
+	MaxRetries int
+	// Backoff is the delay before each retry.
+	Backoff time.Duration
+}
+
+// Result describes how an operation went.
+type Result struct {
+	// Exchanges is the number of APDUs exchanged with the card.
+	Exchanges int
+	// Retries is the number of exchanges that failed and were retried.
+	Retries int
+	// Probes is the number of retries that probed the card state instead of sending
+	// a non-idempotent command again.
+	Probes int
+}
+
+// NewSession returns a session driving the Satscard over the transport.
+func NewSession(satscard *Satscard, transport Transport) *Session {
+
+	return &Session{Satscard: satscard, Transport: transport}
+
+}
+
+// Select runs the ISO applet select, which must be done first whenever the card enters the RF field.
+// The AIDs are optional, as for ISOAppletSelectRequest.
+func (session *Session) Select(ctx context.Context, aids ...[]byte) (*Result, error) {
+	return session.run(ctx, func() ([]byte, error) { return session.Satscard.ISOAppletSelectRequest(aids...) })
+}
+
+// Status runs the status command.
+func (session *Session) Status(ctx context.Context) (*Result, error) {
+	return session.run(ctx, session.Satscard.StatusRequest)
+}
+
+// Read runs the read command, which exposes the current payment address.
+func (session *Session) Read(ctx context.Context) (*Result, error) {
+	return session.run(ctx, session.Satscard.ReadRequest)
+}
+
+// Certs runs the certs, read and check commands, which verify that the card is genuine.
+func (session *Session) Certs(ctx context.Context) (*Result, error) {
+	return session.run(ctx, session.Satscard.CertsRequest)
+}
+
+// Unseal runs the unseal command, which reveals the private key of the active slot.
+func (session *Session) Unseal(ctx context.Context, cvc string) (*Result, error) {
+	return session.run(ctx, func() ([]byte, error) { return session.Satscard.UnsealRequest(cvc) })
+}
+
+// New runs the new command, which sets up the next slot.
+func (session *Session) New(ctx context.Context, cvc string) (*Result, error) {
+	return session.run(ctx, func() ([]byte, error) { return session.Satscard.NewRequest(cvc) })
+}
+
+// Dump runs the dump command for the given slot. The CVC is optional.
+func (session *Session) Dump(ctx context.Context, slot int, cvc string) (*Result, error) {
+	return session.run(ctx, func() ([]byte, error) { return session.Satscard.DumpRequest(slot, cvc) })
+}
+
+// Recover completes an interrupted unseal or new, as done by RecoverRequest.
+func (session *Session) Recover(ctx context.Context, cvc string) (*Result, error) {
+	return session.run(ctx, func() ([]byte, error) { return session.Satscard.RecoverRequest(cvc) })
+}
+
+// Wait runs a single wait command, which lowers the authentication delay.
+func (session *Session) Wait(ctx context.Context) (*Result, error) {
+	return session.run(ctx, session.Satscard.WaitRequest)
+}
+
+// WaitForAuthDelay runs the wait command until the authentication delay has passed.
+// It can be cancelled between and during the waits.
+func (session *Session) WaitForAuthDelay(ctx context.Context) (*Result, error) {
+
+	total := &Result{}
+
+	for session.Satscard.AuthDelay > 0 {
+
+		slog.Debug("SESSION", "AuthDelay", session.Satscard.AuthDelay)
+
+		result, err := session.Wait(ctx)
+
+		if result != nil {
+			total.Exchanges += result.Exchanges
+			total.Retries += result.Retries
+			total.Probes += result.Probes
+		}
+
+		if err != nil {
+			return total, err
+		}
+
+	}
+
+	return total, nil
+
+}
+
+// run sends the first command built by request, and keeps exchanging APDUs with the card
+// until the pipeline is done.
+func (session *Session) run(ctx context.Context, request func() ([]byte, error)) (result *Result, err error) {
+
+	if session.Timeout > 0 {
+
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, session.Timeout)
+		defer cancel()
+
+	}
+
+	result = &Result{}
+
+	// Make sure nothing is left behind when the operation does not finish
+	defer func() {
+		if err != nil {
+			session.Satscard.Reset()
+		}
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	command, err := request()
+
+	for command != nil && err == nil {
+
+		var response []byte
+
+		response, err = session.transmit(ctx, command)
+
+		if err != nil {
+
+			// Give up when the operation was cancelled or is out of retries
+			if ctx.Err() != nil || result.Retries >= session.Retry.MaxRetries {
+				return result, err
+			}
+
+			slog.Debug("SESSION", "Retry", result.Retries+1, "Error", err)
+
+			if err := session.backoff(ctx); err != nil {
+				return result, err
+			}
+
+			var probe bool
+
+			command, probe, err = session.Satscard.retryRequest()
+
+			result.Retries++
+
+			if probe {
+				result.Probes++
+			}
+
+			continue
+		}
+
+		result.Exchanges++
+
+		command, err = session.Satscard.ParseResponse(response)
+
+	}
+
+	return result, err
+
+}
+
+// backoff waits for the retry backoff, or until the context is done.
+func (session *Session) backoff(ctx context.Context) error {
+
+	if session.Retry.Backoff <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(session.Retry.Backoff)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+
+}
+
+// transmit sends a single APDU, bounded by the per-APDU timeout. It returns when the context
+// is done even if the transport does not. An exchange abandoned that way keeps the transport
+// busy until it returns, and the next APDU waits for it rather than being sent concurrently.
+func (session *Session) transmit(ctx context.Context, command []byte) ([]byte, error) {
+
+	session.busyOnce.Do(func() {
+		session.busy = make(chan struct{}, 1)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case session.busy <- struct{}{}:
+	}
+
+	if session.APDUTimeout > 0 {
+
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, session.APDUTimeout)
+		defer cancel()
+
+	}
+
+	type exchange struct {
+		response []byte
+		err      error
+	}
+
+	done := make(chan exchange, 1)
+
+	go func() {
+
+		// Release the transport only once it has returned, even if the exchange was abandoned
+		defer func() { <-session.busy }()
+
+		response, err := session.Transport.Transmit(ctx, command)
+		done <- exchange{response, err}
+
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case exchange := <-done:
+		return exchange.response, exchange.err
+	}
+
+}
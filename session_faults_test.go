@@ -0,0 +1,169 @@
+package tapcards_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/schjonhaug/tapcards"
+	"github.com/schjonhaug/tapcards/faultinject"
+)
+
+func TestSessionFaults(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		command string
+		kind    faultinject.Kind
+		// unsealed starts the card with its first slot unsealed, so new can be sent
+		unsealed bool
+		// operation is the operation run once the applet is selected
+		operation func(session *tapcards.Session, cvc string) (*tapcards.Result, error)
+		// commands are the commands the card received during the operation
+		commands []string
+		retries  int
+		probes   int
+		// slot and state are the active slot and its state afterwards
+		slot  int
+		state tapcards.SlotState
+	}{
+		{"unseal response dropped", "unseal", faultinject.DropResponse, false, unseal, []string{"unseal", "status", "dump"}, 1, 1, 0, tapcards.SlotUnsealed},
+		{"unseal command dropped", "unseal", faultinject.DropCommand, false, unseal, []string{"status", "unseal"}, 1, 1, 0, tapcards.SlotUnsealed},
+		{"new response dropped", "new", faultinject.DropResponse, true, newSlot, []string{"new", "status"}, 1, 1, 1, tapcards.SlotSealed},
+		{"new command dropped", "new", faultinject.DropCommand, true, newSlot, []string{"status", "new"}, 1, 1, 1, tapcards.SlotSealed},
+		{"read response dropped", "read", faultinject.DropResponse, false, read, []string{"read", "status", "read"}, 1, 0, 0, tapcards.SlotSealed},
+		{"read command dropped", "read", faultinject.DropCommand, false, read, []string{"status", "read"}, 1, 0, 0, tapcards.SlotSealed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			card := tapcards.NewSimulatedCard(t)
+
+			if test.unsealed {
+				card.SetSlotUnsealed()
+			}
+
+			transport := faultinject.New(card, nil)
+
+			satscard := card.Satscard()
+
+			session := tapcards.NewSession(satscard, transport)
+			session.Retry = tapcards.RetryPolicy{MaxRetries: 2}
+
+			if _, err := session.Select(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := session.Certs(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			// The fault is only injected into the operation, once the card has been verified
+			card.Commands()
+			transport.Plan = faultinject.NewPlan().OnCommand(test.command, faultinject.Fault{Kind: test.kind})
+
+			result, err := test.operation(session, card.CVC())
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			commands := card.Commands()
+
+			if !reflect.DeepEqual(commands, test.commands) {
+				t.Errorf("commands = %v, want %v", commands, test.commands)
+			}
+
+			if result.Retries != test.retries || result.Probes != test.probes {
+				t.Errorf("%d retries and %d probes, want %d and %d", result.Retries, result.Probes, test.retries, test.probes)
+			}
+
+			if injected := transport.Injected(); len(injected) != 1 || injected[0] != test.kind {
+				t.Errorf("faults injected = %v, want %v", injected, test.kind)
+			}
+
+			if satscard.ActiveSlot != test.slot || satscard.ActiveSlotState() != test.state {
+				t.Errorf("slot %d is %v, want slot %d %v", satscard.ActiveSlot, satscard.ActiveSlotState(), test.slot, test.state)
+			}
+
+			if card.ActiveSlot() != test.slot {
+				t.Errorf("card on slot %d, want %d", card.ActiveSlot(), test.slot)
+			}
+
+		})
+	}
+
+}
+
+func TestSessionOutOfRetries(t *testing.T) {
+
+	card := tapcards.NewSimulatedCard(t)
+
+	transport := faultinject.New(card, nil)
+
+	satscard := card.Satscard()
+
+	session := tapcards.NewSession(satscard, transport)
+	session.Retry = tapcards.RetryPolicy{MaxRetries: 1}
+
+	if _, err := session.Select(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := session.Certs(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	card.Commands()
+
+	// The card leaves the field while unsealing, and the probe cannot reach it either
+	transport.Plan = faultinject.NewPlan().OnCommand("unseal", faultinject.Fault{Kind: faultinject.RemoveCard})
+
+	result, err := session.Unseal(context.Background(), card.CVC())
+
+	if !errors.Is(err, faultinject.ErrCardRemoved) {
+		t.Fatalf("err = %v, want %v", err, faultinject.ErrCardRemoved)
+	}
+
+	if result.Retries != 1 || result.Probes != 1 || result.Exchanges != 0 {
+		t.Errorf("result = %+v, want one retry probing the card", *result)
+	}
+
+	if commands := card.Commands(); len(commands) != 0 {
+		t.Errorf("commands = %v, want none", commands)
+	}
+
+	// Once the card is back, the interrupted unseal is recovered
+	transport.Reinsert()
+
+	if _, err := session.Select(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := session.Recover(context.Background(), card.CVC()); err != nil {
+		t.Fatal(err)
+	}
+
+	if commands, want := card.Commands(), []string{"select", "status", "unseal"}; !reflect.DeepEqual(commands, want) {
+		t.Errorf("commands = %v, want %v", commands, want)
+	}
+
+	if satscard.ActiveSlotState() != tapcards.SlotUnsealed || satscard.ActiveSlotPrivateKey == "" {
+		t.Errorf("slot %v, private key %q", satscard.ActiveSlotState(), satscard.ActiveSlotPrivateKey)
+	}
+
+}
+
+func unseal(session *tapcards.Session, cvc string) (*tapcards.Result, error) {
+	return session.Unseal(context.Background(), cvc)
+}
+
+func newSlot(session *tapcards.Session, cvc string) (*tapcards.Result, error) {
+	return session.New(context.Background(), cvc)
+}
+
+func read(session *tapcards.Session, cvc string) (*tapcards.Result, error) {
+	return session.Read(context.Background())
+}
@@ -0,0 +1,101 @@
+package tapcards
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowTransport ignores the context on its first exchange, as some NFC stacks do, and records
+// how many exchanges were in flight at once.
+type slowTransport struct {
+	mutex     sync.Mutex
+	calls     int
+	active    int
+	maxActive int
+}
+
+var errNoCard = errors.New("no card")
+
+func (transport *slowTransport) Transmit(ctx context.Context, command []byte) ([]byte, error) {
+
+	transport.mutex.Lock()
+	transport.calls++
+	transport.active++
+	call := transport.calls
+	if transport.active > transport.maxActive {
+		transport.maxActive = transport.active
+	}
+	transport.mutex.Unlock()
+
+	if call == 1 {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	transport.mutex.Lock()
+	transport.active--
+	transport.mutex.Unlock()
+
+	return nil, errNoCard
+
+}
+
+func TestSessionRetryWaitsForAbandonedExchange(t *testing.T) {
+
+	transport := &slowTransport{}
+
+	session := NewSession(NewSatscard(), transport)
+	session.APDUTimeout = 10 * time.Millisecond
+	session.Retry = RetryPolicy{MaxRetries: 1}
+
+	result, err := session.Status(context.Background())
+
+	if !errors.Is(err, errNoCard) {
+		t.Fatalf("err = %v, want %v", err, errNoCard)
+	}
+
+	if result.Retries != 1 {
+		t.Errorf("retries = %d, want 1", result.Retries)
+	}
+
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	if transport.calls != 2 {
+		t.Errorf("calls = %d, want 2", transport.calls)
+	}
+
+	if transport.maxActive != 1 {
+		t.Errorf("%d exchanges were in flight at once, want 1", transport.maxActive)
+	}
+
+}
+
+func TestSessionTimeoutWhileTransportBusy(t *testing.T) {
+
+	transport := &slowTransport{}
+
+	session := NewSession(NewSatscard(), transport)
+	session.APDUTimeout = 10 * time.Millisecond
+	session.Retry = RetryPolicy{MaxRetries: 1}
+	session.Timeout = 20 * time.Millisecond
+
+	_, err := session.Status(context.Background())
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Let the abandoned exchange finish before checking
+	time.Sleep(60 * time.Millisecond)
+
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	if transport.calls != 1 {
+		t.Errorf("calls = %d, want 1", transport.calls)
+	}
+
+}
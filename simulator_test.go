@@ -0,0 +1,625 @@
+package tapcards
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/skythen/apdu"
+)
+
+// testRoot is the name of the factory root of simulated cards in the trust store they are verified against.
+const testRoot = "test"
+
+// simulatedSlot is a slot of a simulated card.
+type simulatedSlot struct {
+	state      SlotState
+	masterKey  []byte
+	chainCode  []byte
+	privateKey *btcec.PrivateKey
+}
+
+// simulatedCard is a Transport answering like a SATSCARD, so whole flows can be run without a card.
+// Its keys and nonces are derived from fixed seeds, so every run is the same.
+type simulatedCard struct {
+	t *testing.T
+
+	mutex sync.Mutex
+
+	// cvc is the CVC the card accepts.
+	cvc string
+	// proto, version and birth are reported by status.
+	proto   int
+	version string
+	birth   int
+	// wrongCVCDelay is the authentication delay imposed after a wrong CVC.
+	wrongCVCDelay int
+	// authDelay is the current authentication delay, lowered by one for each wait.
+	authDelay int
+
+	privateKey       *btcec.PrivateKey
+	rootPublicKey    []byte
+	certificateChain [][]byte
+	activeSlot       int
+	slots            []simulatedSlot
+	cardNonce        []byte
+	nonces           uint32
+
+	// dropCommand, if set, is the command whose next exchange fails before it reaches the card.
+	dropCommand string
+	// dropResponse, if set, is the command whose next response is lost after the card executed it.
+	dropResponse string
+
+	// commands records the commands received, including those answered with an error.
+	commands []string
+}
+
+// errFieldLost is returned by the exchanges a simulated card drops, as if it left the RF field.
+var errFieldLost = errors.New("card left the RF field")
+
+// newSimulatedCard returns a card with ten slots, the first of them sealed, whose certificate chain
+// leads through a batch key to the root trusted by its trustStore.
+func newSimulatedCard(t *testing.T) *simulatedCard {
+
+	rootKey := seededKey("root")
+	batchKey := seededKey("batch")
+
+	card := &simulatedCard{
+		t:             t,
+		cvc:           "123456",
+		proto:         1,
+		version:       "1.0.3",
+		birth:         800000,
+		wrongCVCDelay: 3,
+		privateKey:    seededKey("card"),
+		rootPublicKey: rootKey.PubKey().SerializeCompressed(),
+		slots:         make([]simulatedSlot, 10),
+	}
+
+	card.certificateChain = [][]byte{
+		card.certify(batchKey, card.privateKey.PubKey()),
+		card.certify(rootKey, batchKey.PubKey()),
+	}
+
+	card.slots[0] = card.newSlot(0, nil)
+	card.rotateNonce()
+
+	return card
+
+}
+
+// seededKey returns a private key derived from the seed.
+func seededKey(seed string) *btcec.PrivateKey {
+
+	keyBytes := sha256.Sum256([]byte(seed))
+
+	privateKey, _ := btcec.PrivKeyFromBytes(keyBytes[:])
+
+	return privateKey
+
+}
+
+// certify returns the certificate of the public key signed by the signer.
+func (card *simulatedCard) certify(signer *btcec.PrivateKey, publicKey *btcec.PublicKey) []byte {
+
+	digest := sha256.Sum256(publicKey.SerializeCompressed())
+
+	signature, err := ecdsa.SignCompact(signer, digest[:], true)
+
+	if err != nil {
+		card.t.Fatal(err)
+	}
+
+	return signature
+
+}
+
+// newSlot returns a sealed slot whose key is derived as m/0 from a master key picked by the card
+// and the chain code, or a chain code picked by the card if nil.
+func (card *simulatedCard) newSlot(n int, chainCode []byte) simulatedSlot {
+
+	masterKey := sha256.Sum256([]byte(fmt.Sprintf("master %d", n)))
+
+	if chainCode == nil {
+		seed := sha256.Sum256([]byte(fmt.Sprintf("chain code %d", n)))
+		chainCode = seed[:]
+	}
+
+	extendedKey := hdkeychain.NewExtendedKey(chaincfg.MainNetParams.HDPrivateKeyID[:], masterKey[:], chainCode, []byte{0, 0, 0, 0}, 0, 0, true)
+
+	childKey, err := extendedKey.Derive(0)
+
+	if err != nil {
+		card.t.Fatal(err)
+	}
+
+	privateKey, err := childKey.ECPrivKey()
+
+	if err != nil {
+		card.t.Fatal(err)
+	}
+
+	return simulatedSlot{state: SlotSealed, masterKey: masterKey[:], chainCode: chainCode, privateKey: privateKey}
+
+}
+
+// trustStore returns a trust store trusting the root of the card as testRoot.
+func (card *simulatedCard) trustStore() *TrustStore {
+
+	trustStore := NewTrustStore()
+
+	if err := trustStore.AddRoot(testRoot, hex.EncodeToString(card.rootPublicKey)); err != nil {
+		card.t.Fatal(err)
+	}
+
+	return trustStore
+
+}
+
+// satscard returns a Satscard in strict mode, trusting the root of the card.
+func (card *simulatedCard) satscard() *Satscard {
+
+	satscard := NewSatscard()
+	satscard.TrustStore = card.trustStore()
+
+	return satscard
+
+}
+
+// satscardIdentity returns the identity of the card.
+func (card *simulatedCard) satscardIdentity() string {
+
+	identity, err := identity(card.privateKey.PubKey().SerializeCompressed())
+
+	if err != nil {
+		card.t.Fatal(err)
+	}
+
+	return identity
+
+}
+
+// slotPublicKey returns the public key of a slot.
+func (card *simulatedCard) slotPublicKey(slot int) []byte {
+
+	return card.slots[slot].privateKey.PubKey().SerializeCompressed()
+
+}
+
+// slotAddress returns the payment address of a slot.
+func (card *simulatedCard) slotAddress(slot int) string {
+
+	var publicKey [33]byte
+	copy(publicKey[:], card.slotPublicKey(slot))
+
+	address, err := paymentAddress(publicKey)
+
+	if err != nil {
+		card.t.Fatal(err)
+	}
+
+	return address
+
+}
+
+// rotateNonce picks the next card nonce.
+func (card *simulatedCard) rotateNonce() {
+
+	card.nonces++
+
+	var counter [4]byte
+	binary.BigEndian.PutUint32(counter[:], card.nonces)
+
+	nonce := sha256.Sum256(append([]byte("card nonce"), counter[:]...))
+
+	card.cardNonce = nonce[:16]
+
+}
+
+// run exchanges APDUs with the card until the pipeline started by request is done.
+func (card *simulatedCard) run(satscard *Satscard, request func() ([]byte, error)) error {
+
+	command, err := request()
+
+	for command != nil && err == nil {
+
+		var response []byte
+
+		response, err = card.Transmit(context.Background(), command)
+
+		if err != nil {
+			return err
+		}
+
+		command, err = satscard.ParseResponse(response)
+
+	}
+
+	return err
+
+}
+
+func (card *simulatedCard) Transmit(ctx context.Context, command []byte) ([]byte, error) {
+
+	card.mutex.Lock()
+	defer card.mutex.Unlock()
+
+	capdu, err := apdu.ParseCapdu(command)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if capdu.Ins == 0xa4 {
+
+		card.commands = append(card.commands, "select")
+
+		return card.respond(card.status()), nil
+
+	}
+
+	var request map[string]interface{}
+
+	if err := cbor.Unmarshal(capdu.Data, &request); err != nil {
+		return nil, err
+	}
+
+	cmd, _ := request["cmd"].(string)
+
+	if cmd == card.dropCommand {
+		card.dropCommand = ""
+		return nil, errFieldLost
+	}
+
+	card.commands = append(card.commands, cmd)
+
+	var response map[string]interface{}
+
+	switch cmd {
+	case "status":
+		response = card.status()
+	case "read":
+		response = card.read(request)
+	case "certs":
+		response = map[string]interface{}{"cert_chain": card.certificateChain}
+	case "check":
+		response = card.check(request)
+	case "unseal":
+		response = card.unseal(request)
+	case "new":
+		response = card.new(request)
+	case "dump":
+		response = card.dump(request)
+	case "wait":
+		response = card.wait()
+	default:
+		response = cardError(404, "unknown command")
+	}
+
+	if cmd == card.dropResponse {
+		card.dropResponse = ""
+		return nil, errFieldLost
+	}
+
+	return card.respond(response), nil
+
+}
+
+// respond encodes a response with status word 9000.
+func (card *simulatedCard) respond(response map[string]interface{}) []byte {
+
+	data, err := cbor.Marshal(response)
+
+	if err != nil {
+		card.t.Fatal(err)
+	}
+
+	return append(data, 0x90, 0x00)
+
+}
+
+// cardError returns an error response.
+func cardError(code int, message string) map[string]interface{} {
+
+	return map[string]interface{}{"error": message, "code": code}
+
+}
+
+func (card *simulatedCard) status() map[string]interface{} {
+
+	card.rotateNonce()
+
+	response := map[string]interface{}{
+		"proto":      card.proto,
+		"ver":        card.version,
+		"birth":      card.birth,
+		"slots":      []int{card.activeSlot, len(card.slots)},
+		"pubkey":     card.privateKey.PubKey().SerializeCompressed(),
+		"card_nonce": card.cardNonce,
+	}
+
+	if card.slots[card.activeSlot].state == SlotSealed {
+		address := card.slotAddress(card.activeSlot)
+		response["addr"] = address[:12] + "___" + address[len(address)-6:]
+	}
+
+	if card.authDelay > 0 {
+		response["auth_delay"] = card.authDelay
+	}
+
+	return response
+
+}
+
+// sign signs the SHA-256 digest of the message, returning the 64 byte signature without recovery id.
+func (card *simulatedCard) sign(privateKey *btcec.PrivateKey, message []byte) []byte {
+
+	digest := sha256.Sum256(message)
+
+	signature, err := ecdsa.SignCompact(privateKey, digest[:], true)
+
+	if err != nil {
+		card.t.Fatal(err)
+	}
+
+	return signature[1:]
+
+}
+
+func (card *simulatedCard) read(request map[string]interface{}) map[string]interface{} {
+
+	nonce, _ := request["nonce"].([]byte)
+
+	slot := card.slots[card.activeSlot]
+
+	if slot.state == SlotUnused {
+		return cardError(406, "slot not used yet")
+	}
+
+	message := append([]byte(openDime), card.cardNonce...)
+	message = append(message, nonce...)
+	message = append(message, byte(card.activeSlot))
+
+	response := map[string]interface{}{
+		"sig":    card.sign(slot.privateKey, message),
+		"pubkey": slot.privateKey.PubKey().SerializeCompressed(),
+	}
+
+	card.rotateNonce()
+
+	response["card_nonce"] = card.cardNonce
+
+	return response
+
+}
+
+func (card *simulatedCard) check(request map[string]interface{}) map[string]interface{} {
+
+	nonce, _ := request["nonce"].([]byte)
+
+	message := append([]byte(openDime), card.cardNonce...)
+	message = append(message, nonce...)
+
+	// The slot public key is covered while the active slot is sealed
+	if card.slots[card.activeSlot].state == SlotSealed {
+		message = append(message, card.slotPublicKey(card.activeSlot)...)
+	}
+
+	response := map[string]interface{}{"auth_sig": card.sign(card.privateKey, message)}
+
+	card.rotateNonce()
+
+	response["card_nonce"] = card.cardNonce
+
+	return response
+
+}
+
+// authenticate decrypts the CVC of an authenticated command, returning the session key, or the
+// error response if the CVC is wrong or the card is rate limited.
+func (card *simulatedCard) authenticate(cmd string, request map[string]interface{}) ([]byte, map[string]interface{}) {
+
+	if card.authDelay > 0 {
+		return nil, cardError(429, "rate limited")
+	}
+
+	ephemeralPublicKeyBytes, _ := request["epubkey"].([]byte)
+	encryptedCVC, _ := request["xcvc"].([]byte)
+
+	ephemeralPublicKey, err := btcec.ParsePubKey(ephemeralPublicKeyBytes)
+
+	if err != nil {
+		return nil, cardError(400, "bad epubkey")
+	}
+
+	var point btcec.JacobianPoint
+
+	ephemeralPublicKey.AsJacobian(&point)
+	btcec.ScalarMultNonConst(&card.privateKey.Key, &point, &point)
+	point.ToAffine()
+
+	sessionKey := sha256.Sum256(btcec.NewPublicKey(&point.X, &point.Y).SerializeCompressed())
+
+	md := sha256.Sum256(append(append([]byte(nil), card.cardNonce...), cmd...))
+
+	cvc := make([]byte, len(encryptedCVC))
+
+	for i := range cvc {
+		if i < len(sessionKey) {
+			cvc[i] = encryptedCVC[i] ^ sessionKey[i] ^ md[i]
+		}
+	}
+
+	if !bytes.Equal(cvc, []byte(card.cvc)) {
+
+		card.authDelay = card.wrongCVCDelay
+
+		return nil, cardError(401, "bad auth")
+
+	}
+
+	return sessionKey[:], nil
+
+}
+
+// encrypt XORs the private key of a slot with the session key.
+func encrypt(privateKey *btcec.PrivateKey, sessionKey []byte) []byte {
+
+	encrypted := privateKey.Serialize()
+
+	for i := range encrypted {
+		encrypted[i] ^= sessionKey[i]
+	}
+
+	return encrypted
+
+}
+
+// requestedSlot returns the slot of a request, which defaults to zero.
+func requestedSlot(request map[string]interface{}) int {
+
+	slot, _ := request["slot"].(uint64)
+
+	return int(slot)
+
+}
+
+func (card *simulatedCard) unseal(request map[string]interface{}) map[string]interface{} {
+
+	sessionKey, errorResponse := card.authenticate("unseal", request)
+
+	if errorResponse != nil {
+		return errorResponse
+	}
+
+	if requestedSlot(request) != card.activeSlot {
+		return cardError(400, "slot must be active slot")
+	}
+
+	slot := &card.slots[card.activeSlot]
+
+	if slot.state != SlotSealed {
+		return cardError(406, "slot not sealed")
+	}
+
+	slot.state = SlotUnsealed
+
+	card.rotateNonce()
+
+	return map[string]interface{}{
+		"slot":       card.activeSlot,
+		"privkey":    encrypt(slot.privateKey, sessionKey),
+		"pubkey":     slot.privateKey.PubKey().SerializeCompressed(),
+		"master_pk":  slot.masterKey,
+		"chain_code": slot.chainCode,
+		"card_nonce": card.cardNonce,
+	}
+
+}
+
+func (card *simulatedCard) new(request map[string]interface{}) map[string]interface{} {
+
+	_, errorResponse := card.authenticate("new", request)
+
+	if errorResponse != nil {
+		return errorResponse
+	}
+
+	if requestedSlot(request) != card.activeSlot {
+		return cardError(400, "slot must be active slot")
+	}
+
+	if card.slots[card.activeSlot].state != SlotUnsealed {
+		return cardError(406, "current slot not unsealed")
+	}
+
+	if card.activeSlot+1 >= len(card.slots) {
+		return cardError(406, "no more slots")
+	}
+
+	chainCode, _ := request["chain_code"].([]byte)
+
+	card.activeSlot++
+	card.slots[card.activeSlot] = card.newSlot(card.activeSlot, chainCode)
+
+	card.rotateNonce()
+
+	return map[string]interface{}{"slot": card.activeSlot, "card_nonce": card.cardNonce}
+
+}
+
+func (card *simulatedCard) dump(request map[string]interface{}) map[string]interface{} {
+
+	n := requestedSlot(request)
+
+	if n >= len(card.slots) {
+		return cardError(400, "no such slot")
+	}
+
+	slot := card.slots[n]
+
+	var response map[string]interface{}
+
+	switch slot.state {
+	case SlotUnused:
+		response = map[string]interface{}{"slot": n, "used": false}
+	case SlotSealed:
+		response = map[string]interface{}{"slot": n, "sealed": true}
+	default:
+
+		if _, ok := request["epubkey"]; ok {
+
+			sessionKey, errorResponse := card.authenticate("dump", request)
+
+			if errorResponse != nil {
+				return errorResponse
+			}
+
+			response = map[string]interface{}{
+				"slot":       n,
+				"privkey":    encrypt(slot.privateKey, sessionKey),
+				"pubkey":     slot.privateKey.PubKey().SerializeCompressed(),
+				"master_pk":  slot.masterKey,
+				"chain_code": slot.chainCode,
+			}
+
+		} else {
+
+			response = map[string]interface{}{
+				"slot":   n,
+				"pubkey": slot.privateKey.PubKey().SerializeCompressed(),
+				"addr":   card.slotAddress(n),
+			}
+
+		}
+
+	}
+
+	card.rotateNonce()
+
+	response["card_nonce"] = card.cardNonce
+
+	return response
+
+}
+
+func (card *simulatedCard) wait() map[string]interface{} {
+
+	if card.authDelay > 0 {
+		card.authDelay--
+	}
+
+	return map[string]interface{}{"success": true, "auth_delay": card.authDelay}
+
+}
@@ -0,0 +1,143 @@
+package tapcards
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// SlotState is the lifecycle state of a slot on the card.
+type SlotState int
+
+const (
+	// SlotUnknown means the card has not reported the state of the slot yet.
+	SlotUnknown SlotState = iota
+	// SlotUnused means the slot has not been set up with a key yet.
+	SlotUnused
+	// SlotSealed means the slot holds a key whose private part has not been revealed.
+	SlotSealed
+	// SlotUnsealed means the private key of the slot has been revealed.
+	SlotUnsealed
+)
+
+func (state SlotState) String() string {
+
+	switch state {
+	case SlotUnused:
+		return "unused"
+	case SlotSealed:
+		return "sealed"
+	case SlotUnsealed:
+		return "unsealed"
+	default:
+		return "unknown"
+	}
+
+}
+
+// slot holds what is known about a slot on the card.
+type slot struct {
+	// state is the lifecycle state of the slot.
+	state SlotState
+	// publicKey is the public key of the slot, if known.
+	publicKey [33]byte
+	// address is the full payment address of the slot, if known.
+	address string
+	// privateKey is the private key of the slot as WIF, if it has been unsealed and dumped.
+	privateKey string
+	// chainCode is the chain code sent with the new command that set up the slot, if any.
+	chainCode []byte
+}
+
+// SlotState returns the lifecycle state of the given slot, counting from 0.
+func (satscard *Satscard) SlotState(slot int) SlotState {
+
+	if slot < 0 || slot >= len(satscard.slots) {
+		return SlotUnknown
+	}
+
+	return satscard.slots[slot].state
+
+}
+
+// ActiveSlotState returns the lifecycle state of the currently active slot.
+func (satscard *Satscard) ActiveSlotState() SlotState {
+
+	return satscard.SlotState(satscard.ActiveSlot)
+
+}
+
+// updateSlotStates derives the state of every slot from the status of the card.
+// Slots before the active one have been unsealed, slots after it are unused, and the
+// active slot is sealed while the card reports an address for it.
+func (satscard *Satscard) updateSlotStates(activeSlot int, numberOfSlots int, sealed bool) {
+
+	if len(satscard.slots) != numberOfSlots {
+		slots := make([]slot, numberOfSlots)
+		copy(slots, satscard.slots)
+		satscard.slots = slots
+	}
+
+	for i := range satscard.slots {
+
+		switch {
+		case i < activeSlot:
+			satscard.slots[i].state = SlotUnsealed
+		case i > activeSlot:
+			satscard.slots[i] = slot{state: SlotUnused}
+		case sealed:
+			satscard.slots[i].state = SlotSealed
+		default:
+			satscard.slots[i].state = SlotUnsealed
+		}
+
+	}
+
+}
+
+// setSlotState sets the state of a single slot, if it is within range.
+func (satscard *Satscard) setSlotState(slot int, state SlotState) {
+
+	if slot >= 0 && slot < len(satscard.slots) {
+		satscard.slots[slot].state = state
+	}
+
+}
+
+// setSlotChainCode records the chain code sent with the new command that set up the slot.
+func (satscard *Satscard) setSlotChainCode(slot int, chainCode []byte) {
+
+	if slot >= 0 && slot < len(satscard.slots) {
+		satscard.slots[slot].chainCode = chainCode
+	}
+
+}
+
+// verifySlotChainCode checks that the chain code revealed for a slot is the one sent with new,
+// if it is known, so the card cannot ignore the entropy share of the app.
+func (satscard *Satscard) verifySlotChainCode(slot int, chainCode [32]byte) error {
+
+	if slot < 0 || slot >= len(satscard.slots) || satscard.slots[slot].chainCode == nil {
+		return nil
+	}
+
+	if !bytes.Equal(satscard.slots[slot].chainCode, chainCode[:]) {
+		return &UnsealVerificationError{Reason: fmt.Sprintf("chain code of slot %d is not the one sent with new", slot)}
+	}
+
+	return nil
+
+}
+
+// requireActiveSlotState fails with a SlotStateError if the state of the active slot is known
+// and is not the one the command needs.
+func (satscard *Satscard) requireActiveSlotState(command string, required SlotState) error {
+
+	state := satscard.ActiveSlotState()
+
+	if state == SlotUnknown || state == required {
+		return nil
+	}
+
+	return &SlotStateError{Command: command, Slot: satscard.ActiveSlot, State: state}
+
+}
@@ -7,6 +7,8 @@ import (
 
 func (satscard *Satscard) StatusRequest() ([]byte, error) {
 
+	satscard.startPipeline()
+
 	satscard.queue.enqueue("status")
 
 	return satscard.nextCommand()
@@ -31,23 +33,47 @@ func (satscard *Satscard) parseStatusData(statusData statusData) error {
 	slog.Debug("STATUS", "CardNonce", fmt.Sprintf("%x", statusData.CardNonce))
 	slog.Debug("STATUS", "AuthDelay", statusData.AuthDelay)
 
-	satscard.cardPublicKey = statusData.PublicKey
-	satscard.currentCardNonce = statusData.CardNonce
+	if len(statusData.Slots) != 2 {
+		return fmt.Errorf("invalid slots in status: %v", statusData.Slots)
+	}
+
+	if err := satscard.rememberCardNonce(statusData.CardNonce); err != nil {
+		return err
+	}
+
+	// The session is pinned to the first card that answered
+	if satscard.cardPublicKey != [33]byte{} && satscard.cardPublicKey != statusData.PublicKey {
+		return ErrDifferentCard
+	}
 
-	identity, err := identity(satscard.cardPublicKey[:])
+	identity, err := identity(statusData.PublicKey[:])
 
 	if err != nil {
 		return err
 	}
 
+	satscard.cardPublicKey = statusData.PublicKey
+	satscard.currentCardNonce = statusData.CardNonce
+
 	satscard.ActiveSlot = statusData.Slots[0]
 	satscard.NumberOfSlots = statusData.Slots[1]
 	satscard.Identity = identity
-	satscard.ActiveSlotPaymentAddress = statusData.Address
+	satscard.ActiveSlotTruncatedPaymentAddress = statusData.Address
+
+	// Forget the full address if it no longer matches the one reported by the card
+	if !matchesTruncatedAddress(satscard.ActiveSlotPaymentAddress, statusData.Address) {
+		satscard.ActiveSlotPaymentAddress = ""
+	}
+
+	warnNewerProto(statusData.Proto, statusData.Version)
+
 	satscard.Proto = statusData.Proto
 	satscard.Birth = statusData.Birth
 	satscard.Version = statusData.Version
-	satscard.AuthDelay = statusData.AuthDelay
+	satscard.setAuthDelay(statusData.AuthDelay)
+
+	// The card only reports an address while the active slot is sealed
+	satscard.updateSlotStates(satscard.ActiveSlot, satscard.NumberOfSlots, statusData.Address != "")
 
 	return nil
 
@@ -0,0 +1,46 @@
+package tapcards
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStatusPinnedCard(t *testing.T) {
+
+	card := newSimulatedCard(t)
+	satscard := card.satscard()
+
+	tap(t, card, satscard)
+
+	identity := satscard.Identity
+
+	other := newSimulatedCard(t)
+	other.privateKey = seededKey("other card")
+	other.nonces = 1000
+
+	// Both the applet select and status of another card are refused
+	if err := other.run(satscard, func() ([]byte, error) { return satscard.ISOAppletSelectRequest() }); !errors.Is(err, ErrDifferentCard) {
+		t.Errorf("select: err = %v, want %v", err, ErrDifferentCard)
+	}
+
+	if err := other.run(satscard, satscard.StatusRequest); !errors.Is(err, ErrDifferentCard) {
+		t.Errorf("status: err = %v, want %v", err, ErrDifferentCard)
+	}
+
+	if satscard.Identity != identity {
+		t.Errorf("identity changed from %s to %s", identity, satscard.Identity)
+	}
+
+	var cardPublicKey [33]byte
+	copy(cardPublicKey[:], card.privateKey.PubKey().SerializeCompressed())
+
+	if satscard.cardPublicKey != cardPublicKey {
+		t.Error("session pinned to the other card")
+	}
+
+	// The pinned card is still accepted
+	if err := card.run(satscard, satscard.StatusRequest); err != nil {
+		t.Errorf("status of the pinned card: %v", err)
+	}
+
+}
@@ -0,0 +1,304 @@
+package tapcards
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// maxWitnessSignatureSize is the size of the largest DER signature with its sighash type.
+const maxWitnessSignatureSize = 73
+
+// maxSignatureScriptSize is the size of the largest P2PKH signature script, pushing a signature and a
+// compressed public key.
+const maxSignatureScriptSize = 1 + maxWitnessSignatureSize + 1 + 33
+
+// UTXO is an unspent output paid to the address of a slot.
+type UTXO struct {
+	// OutPoint is the transaction hash and output index of the output.
+	OutPoint wire.OutPoint
+	// Value is the amount of the output.
+	Value btcutil.Amount
+	// Type is the script type of the address the output was paid to, as returned by SlotAddresses.
+	// The zero value is P2WPKH, the address the card reports.
+	Type ScriptType
+}
+
+// Sweep describes a transaction moving every UTXO of an unsealed slot to a single destination.
+// It is built and signed offline, and broadcasting it is left to the app.
+type Sweep struct {
+	// PrivateKey is the private key of the unsealed slot as WIF, such as ActiveSlotPrivateKey.
+	PrivateKey string
+	// UTXOs are the unspent outputs paid to any of the addresses of the slot.
+	UTXOs []UTXO
+	// Destination is the address the funds are sent to.
+	Destination string
+	// FeeRate is the fee rate in satoshis per virtual byte.
+	FeeRate float64
+	// RBF signals that the transaction can be replaced by one paying a higher fee (BIP 125).
+	RBF bool
+	// Params are the parameters of the network. If nil, mainnet is used.
+	Params *chaincfg.Params
+}
+
+// ErrNoUTXOs is returned when a sweep has no UTXOs to spend.
+var ErrNoUTXOs = errors.New("nothing to sweep: no UTXOs")
+
+// DustError is returned when the amount left after paying the fee is too small to be relayed.
+type DustError struct {
+	// Amount is what would be sent to the destination.
+	Amount btcutil.Amount
+	// Threshold is the smallest amount the destination output can be relayed with.
+	Threshold btcutil.Amount
+}
+
+func (err *DustError) Error() string {
+	return fmt.Sprintf("cannot sweep: %v left after the fee is below the dust threshold of %v", err.Amount, err.Threshold)
+}
+
+// Build returns the fully signed sweep transaction.
+//
+// The fee is the fee rate times the virtual size of the transaction, computed with the largest possible
+// signatures, so the fee rate paid is never below the one requested.
+func (sweep *Sweep) Build() (*wire.MsgTx, error) {
+
+	wif, err := btcutil.DecodeWIF(sweep.PrivateKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tx, prevOuts, err := sweep.unsignedTx(wif.SerializePubKey())
+
+	if err != nil {
+		return nil, err
+	}
+
+	sigHashes := txscript.NewTxSigHashes(tx, txscript.NewMultiPrevOutFetcher(prevOuts))
+
+	for i, txIn := range tx.TxIn {
+
+		prevOut := prevOuts[txIn.PreviousOutPoint]
+
+		switch {
+		case txscript.IsPayToPubKeyHash(prevOut.PkScript):
+
+			txIn.SignatureScript, err = txscript.SignatureScript(tx, i, prevOut.PkScript, txscript.SigHashAll, wif.PrivKey, true)
+
+		case txscript.IsPayToScriptHash(prevOut.PkScript):
+
+			// The redeem script of P2SH-P2WPKH is the P2WPKH output script, which is signed as such
+			var redeemScript []byte
+
+			redeemScript, err = witnessPubKeyHashScript(wif.SerializePubKey(), sweep.params())
+
+			if err != nil {
+				return nil, err
+			}
+
+			txIn.Witness, err = txscript.WitnessSignature(tx, sigHashes, i, prevOut.Value, redeemScript, txscript.SigHashAll, wif.PrivKey, true)
+
+			if err != nil {
+				return nil, err
+			}
+
+			txIn.SignatureScript, err = pushScript(redeemScript)
+
+		default:
+
+			txIn.Witness, err = txscript.WitnessSignature(tx, sigHashes, i, prevOut.Value, prevOut.PkScript, txscript.SigHashAll, wif.PrivKey, true)
+
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+	}
+
+	return tx, nil
+
+}
+
+// unsignedTx returns the sweep transaction without witnesses, with the fee already deducted,
+// together with the outputs it spends.
+func (sweep *Sweep) unsignedTx(publicKey []byte) (*wire.MsgTx, map[wire.OutPoint]*wire.TxOut, error) {
+
+	if len(sweep.UTXOs) == 0 {
+		return nil, nil, ErrNoUTXOs
+	}
+
+	if sweep.FeeRate <= 0 || math.IsInf(sweep.FeeRate, 0) || math.IsNaN(sweep.FeeRate) {
+		return nil, nil, fmt.Errorf("invalid fee rate: %v", sweep.FeeRate)
+	}
+
+	params := sweep.params()
+
+	destination, err := btcutil.DecodeAddress(sweep.Destination, params)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !destination.IsForNet(params) {
+		return nil, nil, fmt.Errorf("destination %s is not for %s", sweep.Destination, params.Name)
+	}
+
+	destinationScript, err := txscript.PayToAddrScript(destination)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sequence := uint32(wire.MaxTxInSequenceNum)
+
+	if sweep.RBF {
+		sequence = wire.MaxTxInSequenceNum - 2
+	}
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+
+	prevOuts := make(map[wire.OutPoint]*wire.TxOut, len(sweep.UTXOs))
+
+	var total btcutil.Amount
+
+	for _, utxo := range sweep.UTXOs {
+
+		if _, ok := prevOuts[utxo.OutPoint]; ok {
+			return nil, nil, fmt.Errorf("UTXO %v listed twice", utxo.OutPoint)
+		}
+
+		if utxo.Value <= 0 {
+			return nil, nil, fmt.Errorf("invalid value of UTXO %v: %v", utxo.OutPoint, utxo.Value)
+		}
+
+		slotScript, err := outputScript(utxo.Type, publicKey, params)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		prevOuts[utxo.OutPoint] = wire.NewTxOut(int64(utxo.Value), slotScript)
+
+		txIn := wire.NewTxIn(&utxo.OutPoint, nil, nil)
+		txIn.Sequence = sequence
+
+		// Reserve room for the largest signature, so the virtual size is never underestimated
+		switch utxo.Type {
+		case P2PKH:
+
+			txIn.SignatureScript = make([]byte, maxSignatureScriptSize)
+
+		case P2SHP2WPKH:
+
+			redeemScript, err := witnessPubKeyHashScript(publicKey, params)
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			txIn.SignatureScript, err = pushScript(redeemScript)
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			txIn.Witness = wire.TxWitness{make([]byte, maxWitnessSignatureSize), publicKey}
+
+		default:
+
+			txIn.Witness = wire.TxWitness{make([]byte, maxWitnessSignatureSize), publicKey}
+
+		}
+
+		tx.AddTxIn(txIn)
+
+		total += utxo.Value
+
+	}
+
+	txOut := wire.NewTxOut(0, destinationScript)
+
+	tx.AddTxOut(txOut)
+
+	vsize := virtualSize(tx)
+
+	fee := btcutil.Amount(math.Ceil(sweep.FeeRate * float64(vsize)))
+
+	txOut.Value = int64(total - fee)
+
+	if threshold := dustThreshold(txOut); total-fee < threshold {
+		return nil, nil, &DustError{Amount: total - fee, Threshold: threshold}
+	}
+
+	for _, txIn := range tx.TxIn {
+		txIn.SignatureScript = nil
+		txIn.Witness = nil
+	}
+
+	return tx, prevOuts, nil
+
+}
+
+// params returns the parameters of the network of the sweep.
+func (sweep *Sweep) params() *chaincfg.Params {
+
+	if sweep.Params != nil {
+		return sweep.Params
+	}
+
+	return &chaincfg.MainNetParams
+
+}
+
+// pushScript returns a signature script pushing the given redeem script.
+func pushScript(redeemScript []byte) ([]byte, error) {
+
+	return txscript.NewScriptBuilder().AddData(redeemScript).Script()
+
+}
+
+// witnessPubKeyHashScript returns the P2WPKH output script of a public key.
+func witnessPubKeyHashScript(publicKey []byte, params *chaincfg.Params) ([]byte, error) {
+
+	address, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(publicKey), params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return txscript.PayToAddrScript(address)
+
+}
+
+// virtualSize returns the virtual size of a transaction in virtual bytes, as defined in BIP 141.
+func virtualSize(tx *wire.MsgTx) int64 {
+
+	weight := int64(tx.SerializeSizeStripped()*3 + tx.SerializeSize())
+
+	return (weight + 3) / 4
+
+}
+
+// dustThreshold returns the smallest value of an output that is relayed with the default dust relay fee
+// of 3 satoshis per virtual byte, which is what it costs to create and spend the output.
+func dustThreshold(txOut *wire.TxOut) btcutil.Amount {
+
+	// Outpoint, script length and sequence of the input spending the output
+	size := txOut.SerializeSize() + 41
+
+	// Signature and public key, which are discounted for witness programs
+	if txscript.IsWitnessProgram(txOut.PkScript) {
+		size += 107 / 4
+	} else {
+		size += 107
+	}
+
+	return btcutil.Amount(3 * size)
+
+}
@@ -0,0 +1,288 @@
+package tapcards
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testKey returns a private key derived from the seed, and its WIF.
+func testKey(t *testing.T, seed string) (*btcec.PrivateKey, string) {
+
+	keyBytes := sha256.Sum256([]byte(seed))
+
+	privateKey, _ := btcec.PrivKeyFromBytes(keyBytes[:])
+
+	wif, err := btcutil.NewWIF(privateKey, &chaincfg.MainNetParams, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return privateKey, wif.String()
+
+}
+
+// testAddress returns the address of the given script type of the key derived from the seed.
+func testAddress(t *testing.T, seed string, scriptType ScriptType) string {
+
+	privateKey, _ := testKey(t, seed)
+
+	address, err := scriptAddress(scriptType, privateKey.PubKey().SerializeCompressed(), &chaincfg.MainNetParams)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return address.EncodeAddress()
+
+}
+
+// testOutPoint returns an outpoint of a made up transaction.
+func testOutPoint(n byte) wire.OutPoint {
+
+	return wire.OutPoint{Hash: [32]byte{n}, Index: uint32(n)}
+
+}
+
+// executeInputs runs the scripts of every input of the transaction, failing the test if any is invalid.
+func executeInputs(t *testing.T, tx *wire.MsgTx, prevOuts map[wire.OutPoint]*wire.TxOut) {
+
+	fetcher := txscript.NewMultiPrevOutFetcher(prevOuts)
+	sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+
+	for i, txIn := range tx.TxIn {
+
+		prevOut := prevOuts[txIn.PreviousOutPoint]
+
+		engine, err := txscript.NewEngine(prevOut.PkScript, tx, i, txscript.StandardVerifyFlags, nil, sigHashes, prevOut.Value, fetcher)
+
+		if err != nil {
+			t.Fatalf("input %d: %v", i, err)
+		}
+
+		if err := engine.Execute(); err != nil {
+			t.Errorf("input %d: %v", i, err)
+		}
+
+	}
+
+}
+
+// prevOutsOf returns the outputs spent by the UTXOs of a sweep.
+func prevOutsOf(t *testing.T, sweep *Sweep, publicKey []byte) map[wire.OutPoint]*wire.TxOut {
+
+	prevOuts := make(map[wire.OutPoint]*wire.TxOut)
+
+	for _, utxo := range sweep.UTXOs {
+
+		script, err := outputScript(utxo.Type, publicKey, sweep.params())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		prevOuts[utxo.OutPoint] = wire.NewTxOut(int64(utxo.Value), script)
+
+	}
+
+	return prevOuts
+
+}
+
+func TestSweepBuild(t *testing.T) {
+
+	privateKey, wif := testKey(t, "slot")
+	publicKey := privateKey.PubKey().SerializeCompressed()
+
+	tests := []struct {
+		name  string
+		types []ScriptType
+	}{
+		{"p2wpkh", []ScriptType{P2WPKH}},
+		{"p2sh-p2wpkh", []ScriptType{P2SHP2WPKH}},
+		{"p2pkh", []ScriptType{P2PKH}},
+		{"mixed", []ScriptType{P2WPKH, P2SHP2WPKH, P2PKH, P2WPKH}},
+	}
+
+	for _, test := range tests {
+		for _, feeRate := range []float64{1, 12.5, 101.3} {
+
+			sweep := &Sweep{
+				PrivateKey:  wif,
+				Destination: testAddress(t, "destination", P2WPKH),
+				FeeRate:     feeRate,
+			}
+
+			var total btcutil.Amount
+
+			for i, scriptType := range test.types {
+
+				value := btcutil.Amount(100000 * (i + 1))
+
+				sweep.UTXOs = append(sweep.UTXOs, UTXO{OutPoint: testOutPoint(byte(i + 1)), Value: value, Type: scriptType})
+
+				total += value
+
+			}
+
+			tx, err := sweep.Build()
+
+			if err != nil {
+				t.Fatalf("%s at %v sat/vB: %v", test.name, feeRate, err)
+			}
+
+			executeInputs(t, tx, prevOutsOf(t, sweep, publicKey))
+
+			if len(tx.TxOut) != 1 {
+				t.Fatalf("%s: %d outputs, want 1", test.name, len(tx.TxOut))
+			}
+
+			fee := total - btcutil.Amount(tx.TxOut[0].Value)
+
+			if minimum := btcutil.Amount(math.Ceil(feeRate * float64(virtualSize(tx)))); fee < minimum {
+				t.Errorf("%s at %v sat/vB: fee %v is below %v for %d vB", test.name, feeRate, fee, minimum, virtualSize(tx))
+			}
+
+			for i, txIn := range tx.TxIn {
+				if txIn.Sequence != wire.MaxTxInSequenceNum {
+					t.Errorf("%s: sequence of input %d = %x, want %x", test.name, i, txIn.Sequence, uint32(wire.MaxTxInSequenceNum))
+				}
+			}
+
+		}
+	}
+
+}
+
+func TestSweepRBF(t *testing.T) {
+
+	_, wif := testKey(t, "slot")
+
+	sweep := &Sweep{
+		PrivateKey:  wif,
+		UTXOs:       []UTXO{{OutPoint: testOutPoint(1), Value: 100000}, {OutPoint: testOutPoint(2), Value: 100000, Type: P2PKH}},
+		Destination: testAddress(t, "destination", P2WPKH),
+		FeeRate:     2,
+		RBF:         true,
+	}
+
+	tx, err := sweep.Build()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, txIn := range tx.TxIn {
+
+		// BIP 125 signals replaceability with any sequence below 0xfffffffe
+		if txIn.Sequence != wire.MaxTxInSequenceNum-2 {
+			t.Errorf("sequence of input %d = %x, want %x", i, txIn.Sequence, uint32(wire.MaxTxInSequenceNum-2))
+		}
+
+	}
+
+}
+
+func TestSweepDust(t *testing.T) {
+
+	_, wif := testKey(t, "slot")
+
+	tests := []struct {
+		name        string
+		destination ScriptType
+		threshold   btcutil.Amount
+	}{
+		{"p2wpkh destination", P2WPKH, 294},
+		{"p2pkh destination", P2PKH, 546},
+	}
+
+	for _, test := range tests {
+
+		sweep := &Sweep{
+			PrivateKey:  wif,
+			UTXOs:       []UTXO{{OutPoint: testOutPoint(1), Value: 100000}},
+			Destination: testAddress(t, "destination", test.destination),
+			FeeRate:     1,
+		}
+
+		tx, err := sweep.Build()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The fee does not depend on the value, so it is the same for every amount below
+		fee := 100000 - btcutil.Amount(tx.TxOut[0].Value)
+
+		sweep.UTXOs[0].Value = fee + test.threshold
+
+		tx, err = sweep.Build()
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if amount := btcutil.Amount(tx.TxOut[0].Value); amount != test.threshold {
+			t.Errorf("%s: amount = %v, want %v", test.name, amount, test.threshold)
+		}
+
+		sweep.UTXOs[0].Value = fee + test.threshold - 1
+
+		var dustError *DustError
+
+		if _, err := sweep.Build(); !errors.As(err, &dustError) {
+			t.Fatalf("%s: err = %v, want a DustError", test.name, err)
+		}
+
+		if dustError.Threshold != test.threshold || dustError.Amount != test.threshold-1 {
+			t.Errorf("%s: %v, want %v below %v", test.name, dustError, test.threshold-1, test.threshold)
+		}
+
+	}
+
+}
+
+func TestSweepInvalidUTXOs(t *testing.T) {
+
+	_, wif := testKey(t, "slot")
+
+	tests := []struct {
+		name  string
+		utxos []UTXO
+	}{
+		{"none", nil},
+		{"duplicate", []UTXO{{OutPoint: testOutPoint(1), Value: 100000}, {OutPoint: testOutPoint(1), Value: 100000, Type: P2PKH}}},
+		{"zero value", []UTXO{{OutPoint: testOutPoint(1), Value: 100000}, {OutPoint: testOutPoint(2)}}},
+		{"negative value", []UTXO{{OutPoint: testOutPoint(1), Value: -1}}},
+	}
+
+	for _, test := range tests {
+
+		sweep := &Sweep{
+			PrivateKey:  wif,
+			UTXOs:       test.utxos,
+			Destination: testAddress(t, "destination", P2WPKH),
+			FeeRate:     1,
+		}
+
+		if _, err := sweep.Build(); err == nil {
+			t.Errorf("%s: sweep built", test.name)
+		}
+
+	}
+
+	sweep := &Sweep{PrivateKey: wif, Destination: testAddress(t, "destination", P2WPKH), FeeRate: 1}
+
+	if _, err := sweep.Build(); !errors.Is(err, ErrNoUTXOs) {
+		t.Errorf("err = %v, want %v", err, ErrNoUTXOs)
+	}
+
+}
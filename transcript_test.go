@@ -0,0 +1,270 @@
+package tapcards
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// countingReader returns 0x01, 0x02, 0x03 and so on, so every random byte of a session is known.
+type countingReader struct {
+	next byte
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+
+	for i := range p {
+		reader.next++
+		p[i] = reader.next
+	}
+
+	return len(p), nil
+
+}
+
+// counting returns n bytes of the sequence of countingReader, starting at first.
+func counting(first byte, n int) []byte {
+
+	sequence := make([]byte, n)
+
+	for i := range sequence {
+		sequence[i] = first + byte(i)
+	}
+
+	return sequence
+
+}
+
+// The card of the transcripts below, whose private key is SHA-256("card"). Its slot 0 key is m/0 of
+// master private key SHA-256("master") and chain code SHA-256("chain code"). The keys, signatures,
+// session keys and encrypted values were computed independently of this library, following the
+// protocol description, so they do not share a mistake with the code under test.
+const (
+	transcriptCardPublicKey    = "0216252d81a51db2e1c480147613e904d23b91f7249997ac54a309887f5b5de73b"
+	transcriptMasterPrivateKey = "fc613b4dfd6736a7bd268c8a0e74ed0d1c04a959f59dd74ef2874983fd443fc9"
+	transcriptChainCode        = "bf99352eb2cecf2b7b576dc38f26ed9dc394f33c335c4dc80055e6a445a0e078"
+	transcriptSlotPublicKey    = "0238559c9f8c12fd3232347d1566b3ded856cf8838405d97aeed64530f88d82381"
+	transcriptAddress          = "bc1qek5vztrdqz5r3uh646p9rvzx55873kvdq08zqx"
+	transcriptWIF              = "L5cb8NfCv9Nw1fGkaaUnhPVRXjb6tUb5cp1snK6iU66M9RrA8VEx"
+)
+
+// responseAPDU wraps a CBOR response into a response APDU with status word 9000.
+func responseAPDU(t *testing.T, value interface{}) []byte {
+
+	data, err := cbor.Marshal(value)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(data, 0x90, 0x00)
+
+}
+
+func unhex(t *testing.T, parts ...string) []byte {
+
+	var decoded []byte
+
+	for _, part := range parts {
+
+		b, err := hex.DecodeString(part)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded = append(decoded, b...)
+
+	}
+
+	return decoded
+
+}
+
+// TestTranscript replays status, read, unseal and new with a fixed source of randomness, and checks
+// the command APDUs byte for byte and the state parsed from the responses.
+func TestTranscript(t *testing.T) {
+
+	cardNonces := [][]byte{counting(0xa0, 16), counting(0xb0, 16), counting(0xc0, 16), counting(0xd0, 16)}
+
+	satscard := Satscard{Rand: &countingReader{}}
+
+	// status
+
+	request, err := satscard.StatusRequest()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// {"cmd": "status"}
+	if want := unhex(t, "00cb00000c", "a1", "63636d64", "66737461747573"); !bytes.Equal(request, want) {
+		t.Fatalf("status request = %x, want %x", request, want)
+	}
+
+	request, err = satscard.ParseResponse(responseAPDU(t, map[string]interface{}{
+		"proto":      1,
+		"ver":        "1.0.0",
+		"birth":      700000,
+		"slots":      []int{0, 10},
+		"addr":       "bc1qek5vztrd___q08zqx",
+		"pubkey":     unhex(t, transcriptCardPublicKey),
+		"card_nonce": cardNonces[0],
+	}))
+
+	if err != nil || request != nil {
+		t.Fatalf("ParseResponse(status) = %x, %v", request, err)
+	}
+
+	if satscard.Proto != 1 || satscard.Version != "1.0.0" || satscard.Birth != 700000 {
+		t.Errorf("proto, version and birth = %d, %q, %d", satscard.Proto, satscard.Version, satscard.Birth)
+	}
+
+	if satscard.ActiveSlot != 0 || satscard.NumberOfSlots != 10 || satscard.ActiveSlotState() != SlotSealed {
+		t.Errorf("slot %d of %d is %v, want slot 0 of 10 sealed", satscard.ActiveSlot, satscard.NumberOfSlots, satscard.ActiveSlotState())
+	}
+
+	// read, with the first 16 random bytes as nonce
+
+	request, err = satscard.ReadRequest()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// {"cmd": "read", "nonce": h'0102...10'}
+	if want := unhex(t, "00cb000021", "a2", "63636d64", "6472656164", "656e6f6e6365", "50", hex.EncodeToString(counting(0x01, 16))); !bytes.Equal(request, want) {
+		t.Fatalf("read request = %x, want %x", request, want)
+	}
+
+	// The slot key signs "OPENDIME", the card nonce, the app nonce and the slot number
+	request, err = satscard.ParseResponse(responseAPDU(t, map[string]interface{}{
+		"sig":        unhex(t, "21ca9a97e9d7d543fbd130263853cad01387a2f57119fa7068b95041ada69270", "6552efb663c22cc1aabca0d34032460ff8682cd5d18386af66b8c571070d4543"),
+		"pubkey":     unhex(t, transcriptSlotPublicKey),
+		"card_nonce": cardNonces[1],
+	}))
+
+	if err != nil || request != nil {
+		t.Fatalf("ParseResponse(read) = %x, %v", request, err)
+	}
+
+	if satscard.ActiveSlotPaymentAddress != transcriptAddress {
+		t.Errorf("address = %q, want %q", satscard.ActiveSlotPaymentAddress, transcriptAddress)
+	}
+
+	// unseal, with the next 32 random bytes as ephemeral private key
+
+	request, err = satscard.UnsealRequest("123456")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With the ephemeral private key 1112...30, the session key, SHA-256 of the shared ECDH point, is
+	// b270a4015cccc972b23e4942154aa2b3e13cdcc3f023a19fdc06c63ccaddd6cb. The CVC is XORed with it and
+	// with SHA-256 of the card nonce and "unseal".
+
+	// {"cmd": "unseal", "epubkey": h'...', "xcvc": h'...', "slot": 0}
+	want := unhex(t, "00cb000049", "a4", "63636d64", "66756e7365616c",
+		"67657075626b6579", "5821", "029b97f3e12dac7aa011582c831049640bfcff00adfe003625db4e34d5220e085e",
+		"6478637663", "46", "20722b8562ef",
+		"64736c6f74", "00")
+
+	if !bytes.Equal(request, want) {
+		t.Fatalf("unseal request = %x, want %x", request, want)
+	}
+
+	// The slot private key is returned XORed with the session key
+	request, err = satscard.ParseResponse(responseAPDU(t, map[string]interface{}{
+		"slot":       0,
+		"privkey":    unhex(t, "48075dbbc6eead24a395d3a8cc04a9ea262fdf7cb4afe50beb641b29692947ea"),
+		"pubkey":     unhex(t, transcriptSlotPublicKey),
+		"master_pk":  unhex(t, transcriptMasterPrivateKey),
+		"chain_code": unhex(t, transcriptChainCode),
+		"card_nonce": cardNonces[2],
+	}))
+
+	if err != nil || request != nil {
+		t.Fatalf("ParseResponse(unseal) = %x, %v", request, err)
+	}
+
+	if satscard.ActiveSlotPrivateKey != transcriptWIF {
+		t.Errorf("private key = %q, want %q", satscard.ActiveSlotPrivateKey, transcriptWIF)
+	}
+
+	if satscard.ActiveSlotState() != SlotUnsealed {
+		t.Errorf("slot 0 is %v, want unsealed", satscard.ActiveSlotState())
+	}
+
+	// new, with the next 32 random bytes as ephemeral private key and the 32 after as chain code
+
+	request, err = satscard.NewRequest("123456")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// {"cmd": "new", "epubkey": h'...', "xcvc": h'...', "slot": 0, "chain_code": h'5152...70'}
+	want = unhex(t, "00cb000073", "a5", "63636d64", "636e6577",
+		"67657075626b6579", "5821", "03e5a9d2eae7c91340552f83c903203c5a40a46f38dfd4f79395f45a87601045e0",
+		"6478637663", "46", "8821e40beeec",
+		"64736c6f74", "00",
+		"6a636861696e5f636f6465", "5820", hex.EncodeToString(counting(0x51, 32)))
+
+	if !bytes.Equal(request, want) {
+		t.Fatalf("new request = %x, want %x", request, want)
+	}
+
+	request, err = satscard.ParseResponse(responseAPDU(t, map[string]interface{}{
+		"slot":       1,
+		"card_nonce": cardNonces[3],
+	}))
+
+	if err != nil || request != nil {
+		t.Fatalf("ParseResponse(new) = %x, %v", request, err)
+	}
+
+	if satscard.ActiveSlot != 1 || satscard.ActiveSlotState() != SlotSealed {
+		t.Errorf("slot %d is %v, want slot 1 sealed", satscard.ActiveSlot, satscard.ActiveSlotState())
+	}
+
+}
+
+// TestTranscriptWithoutChainCode checks that new leaves out the chain code on firmware that predates it.
+func TestTranscriptWithoutChainCode(t *testing.T) {
+
+	var cardPublicKey [33]byte
+	copy(cardPublicKey[:], unhex(t, transcriptCardPublicKey))
+
+	cardNonce := counting(0xa0, 16)
+
+	satscard := Satscard{
+		Rand:          &countingReader{},
+		Proto:         1,
+		Version:       "0.9.0",
+		NumberOfSlots: 10,
+		slots:         []slot{{state: SlotUnsealed}, {state: SlotUnused}},
+	}
+
+	satscard.cardPublicKey = cardPublicKey
+	copy(satscard.currentCardNonce[:], cardNonce)
+
+	request, err := satscard.NewRequest("123456")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// {"cmd": "new", "epubkey": h'...', "xcvc": h'...', "slot": 0}
+	want := unhex(t, "00cb000046", "a4", "63636d64", "636e6577",
+		"67657075626b6579", "5821", "0284bf7562262bbd6940085748f3be6afa52ae317155181ece31b66351ccffa4b0",
+		"6478637663", "46", "9789f1507eee",
+		"64736c6f74", "00")
+
+	if !bytes.Equal(request, want) {
+		t.Fatalf("new request = %x, want %x", request, want)
+	}
+
+}
@@ -0,0 +1,155 @@
+package tapcards
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// Names of the factory roots known to the library.
+const (
+	// ProductionRoot is the name of the factory root used by genuine Coinkite cards.
+	ProductionRoot = "production"
+	// EmulatorRoot is the name of the factory root used by the Coinkite emulator.
+	EmulatorRoot = "emulator"
+)
+
+const (
+	productionRootPublicKey = "03028a0e89e70d0ec0d932053a89ab1da7d9182bdc6d2f03e706ee99517d05d9e1"
+	emulatorRootPublicKey   = "022b6750a0c09f632df32afc5bef66568667e04b2e0f57cb8640ac5a040179442b"
+)
+
+// defaultTrustStore is used by every Satscard that has no TrustStore of its own.
+var defaultTrustStore = mustTrustStore(map[string]string{ProductionRoot: productionRootPublicKey})
+
+// trustedRoot is a named factory root public key.
+type trustedRoot struct {
+	name      string
+	publicKey [33]byte
+}
+
+// TrustStore is a set of named factory root public keys. A card is considered
+// genuine when its certificate chain leads to any of the roots in the store.
+// A TrustStore is safe for concurrent use.
+type TrustStore struct {
+	mutex sync.RWMutex
+	roots []trustedRoot
+}
+
+// NewTrustStore returns an empty trust store.
+func NewTrustStore() *TrustStore {
+	return &TrustStore{}
+}
+
+// DefaultTrustStore returns a copy of the trust store used by sessions that do not set their own.
+// Release builds only trust the production root. Builds made with the tapcards_emulator
+// build tag also trust the emulator root.
+func DefaultTrustStore() *TrustStore {
+	return defaultTrustStore.clone()
+}
+
+// mustTrustStore creates a trust store from hex encoded roots known at compile time.
+// It panics if any of them fail to parse.
+func mustTrustStore(roots map[string]string) *TrustStore {
+
+	trustStore := NewTrustStore()
+
+	for name, publicKey := range roots {
+		if err := trustStore.AddRoot(name, publicKey); err != nil {
+			panic(err)
+		}
+	}
+
+	return trustStore
+}
+
+// AddRoot adds a hex encoded, compressed factory root public key to the trust store under the given name.
+// Adding a name that already exists replaces its public key.
+func (trustStore *TrustStore) AddRoot(name string, publicKey string) error {
+
+	publicKeyBytes, err := hex.DecodeString(publicKey)
+	if err != nil {
+		return fmt.Errorf("factory root %q: %w", name, err)
+	}
+
+	parsedPublicKey, err := btcec.ParsePubKey(publicKeyBytes)
+	if err != nil {
+		return fmt.Errorf("factory root %q: %w", name, err)
+	}
+
+	root := trustedRoot{name: name}
+	copy(root.publicKey[:], parsedPublicKey.SerializeCompressed())
+
+	trustStore.mutex.Lock()
+	defer trustStore.mutex.Unlock()
+
+	for i := range trustStore.roots {
+		if trustStore.roots[i].name == name {
+			trustStore.roots[i] = root
+			return nil
+		}
+	}
+
+	trustStore.roots = append(trustStore.roots, root)
+
+	return nil
+}
+
+// RemoveRoot removes the factory root with the given name from the trust store, if present.
+func (trustStore *TrustStore) RemoveRoot(name string) {
+
+	trustStore.mutex.Lock()
+	defer trustStore.mutex.Unlock()
+
+	for i := range trustStore.roots {
+		if trustStore.roots[i].name == name {
+			trustStore.roots = append(trustStore.roots[:i], trustStore.roots[i+1:]...)
+			return
+		}
+	}
+}
+
+// Trusts reports whether the trust store contains a root with the given name.
+func (trustStore *TrustStore) Trusts(name string) bool {
+
+	trustStore.mutex.RLock()
+	defer trustStore.mutex.RUnlock()
+
+	for _, root := range trustStore.roots {
+		if root.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// match returns the name of the root equal to the given public key.
+// It returns false if the public key is not trusted.
+func (trustStore *TrustStore) match(publicKey *btcec.PublicKey) (string, bool) {
+
+	var serialized [33]byte
+	copy(serialized[:], publicKey.SerializeCompressed())
+
+	trustStore.mutex.RLock()
+	defer trustStore.mutex.RUnlock()
+
+	for _, root := range trustStore.roots {
+		if root.publicKey == serialized {
+			return root.name, true
+		}
+	}
+
+	return "", false
+}
+
+// clone returns an independent copy of the trust store.
+func (trustStore *TrustStore) clone() *TrustStore {
+
+	trustStore.mutex.RLock()
+	defer trustStore.mutex.RUnlock()
+
+	return &TrustStore{roots: append([]trustedRoot(nil), trustStore.roots...)}
+}
@@ -0,0 +1,20 @@
+//go:build tapcards_emulator
+
+package tapcards
+
+// QA builds made with the tapcards_emulator build tag trust the emulator root by default,
+// in addition to the production root.
+func init() {
+	if err := defaultTrustStore.AddRoot(EmulatorRoot, emulatorRootPublicKey); err != nil {
+		panic(err)
+	}
+}
+
+// UseEmulator is a function that makes the emulator factory root the only root trusted by default.
+// Sessions with their own TrustStore are not affected. It is meant for development against the
+// emulator only, and is not available in release builds.
+func UseEmulator() {
+
+	defaultTrustStore.RemoveRoot(ProductionRoot)
+
+}
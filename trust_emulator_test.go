@@ -0,0 +1,35 @@
+//go:build tapcards_emulator
+
+package tapcards
+
+import "testing"
+
+func TestDefaultTrustStoreIncludesEmulator(t *testing.T) {
+
+	trustStore := DefaultTrustStore()
+
+	if !trustStore.Trusts(ProductionRoot) || !trustStore.Trusts(EmulatorRoot) {
+		t.Errorf("trusts production %v and emulator %v, want both", trustStore.Trusts(ProductionRoot), trustStore.Trusts(EmulatorRoot))
+	}
+
+	if name, trusted := trustStore.match(parsePublicKey(t, emulatorRootPublicKey)); !trusted || name != EmulatorRoot {
+		t.Errorf("emulator root public key matched %q, %v", name, trusted)
+	}
+
+}
+
+func TestUseEmulator(t *testing.T) {
+
+	defer func() {
+		if err := defaultTrustStore.AddRoot(ProductionRoot, productionRootPublicKey); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	UseEmulator()
+
+	if defaultTrustStore.Trusts(ProductionRoot) || !defaultTrustStore.Trusts(EmulatorRoot) {
+		t.Error("UseEmulator did not leave the emulator root as the only trusted root")
+	}
+
+}
@@ -0,0 +1,23 @@
+//go:build !tapcards_emulator
+
+package tapcards
+
+import "testing"
+
+func TestDefaultTrustStoreExcludesEmulator(t *testing.T) {
+
+	trustStore := DefaultTrustStore()
+
+	if !trustStore.Trusts(ProductionRoot) {
+		t.Error("production root not trusted")
+	}
+
+	if trustStore.Trusts(EmulatorRoot) {
+		t.Error("emulator root trusted without the tapcards_emulator build tag")
+	}
+
+	if _, trusted := trustStore.match(parsePublicKey(t, emulatorRootPublicKey)); trusted {
+		t.Error("emulator root public key trusted without the tapcards_emulator build tag")
+	}
+
+}
@@ -0,0 +1,135 @@
+package tapcards
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// parsePublicKey parses a hex encoded, compressed public key.
+func parsePublicKey(t *testing.T, publicKey string) *btcec.PublicKey {
+
+	publicKeyBytes, err := hex.DecodeString(publicKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsedPublicKey, err := btcec.ParsePubKey(publicKeyBytes)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return parsedPublicKey
+
+}
+
+func TestTrustStoreAddAndRemove(t *testing.T) {
+
+	trustStore := NewTrustStore()
+
+	if _, trusted := trustStore.match(parsePublicKey(t, productionRootPublicKey)); trusted {
+		t.Error("empty trust store trusts the production root")
+	}
+
+	if err := trustStore.AddRoot(ProductionRoot, productionRootPublicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := trustStore.AddRoot("batch", emulatorRootPublicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		publicKey string
+		name      string
+	}{
+		{productionRootPublicKey, ProductionRoot},
+		{emulatorRootPublicKey, "batch"},
+	}
+
+	for _, test := range tests {
+		if name, trusted := trustStore.match(parsePublicKey(t, test.publicKey)); !trusted || name != test.name {
+			t.Errorf("match(%s) = %q, %v, want %q", test.publicKey, name, trusted, test.name)
+		}
+	}
+
+	// Adding a name again replaces its public key
+	if err := trustStore.AddRoot("batch", productionRootPublicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, trusted := trustStore.match(parsePublicKey(t, emulatorRootPublicKey)); trusted {
+		t.Error("replaced root is still trusted")
+	}
+
+	trustStore.RemoveRoot(ProductionRoot)
+	trustStore.RemoveRoot("unknown")
+
+	if trustStore.Trusts(ProductionRoot) || !trustStore.Trusts("batch") {
+		t.Errorf("trusts production %v and batch %v, want false and true", trustStore.Trusts(ProductionRoot), trustStore.Trusts("batch"))
+	}
+
+	if name, _ := trustStore.match(parsePublicKey(t, productionRootPublicKey)); name != "batch" {
+		t.Errorf("production root public key matched %q, want batch", name)
+	}
+
+}
+
+func TestTrustStoreAddInvalidRoot(t *testing.T) {
+
+	trustStore := NewTrustStore()
+
+	for _, publicKey := range []string{"", "zz", "05" + productionRootPublicKey[2:], productionRootPublicKey[:64]} {
+		if err := trustStore.AddRoot("invalid", publicKey); err == nil {
+			t.Errorf("AddRoot(%q) succeeded", publicKey)
+		}
+	}
+
+	if trustStore.Trusts("invalid") {
+		t.Error("invalid root added")
+	}
+
+}
+
+func TestTrustStoreClone(t *testing.T) {
+
+	trustStore := DefaultTrustStore()
+
+	if err := trustStore.AddRoot("batch", emulatorRootPublicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	trustStore.RemoveRoot(ProductionRoot)
+
+	// Changing a copy leaves the default store alone
+	if !defaultTrustStore.Trusts(ProductionRoot) || defaultTrustStore.Trusts("batch") {
+		t.Error("default trust store changed through its copy")
+	}
+
+	clone := trustStore.clone()
+	clone.RemoveRoot("batch")
+
+	if !trustStore.Trusts("batch") {
+		t.Error("trust store changed through its clone")
+	}
+
+}
+
+func TestSatscardTrustStore(t *testing.T) {
+
+	var satscard Satscard
+
+	if satscard.trustStore() != defaultTrustStore {
+		t.Error("session without a trust store does not use the default one")
+	}
+
+	satscard.TrustStore = NewTrustStore()
+
+	if satscard.trustStore() != satscard.TrustStore {
+		t.Error("session does not use its own trust store")
+	}
+
+}
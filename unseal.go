@@ -6,6 +6,7 @@ import (
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/btcsuite/btcd/chaincfg"
 )
 
@@ -13,13 +14,18 @@ func (satscard *Satscard) UnsealRequest(cvc string) ([]byte, error) {
 
 	slog.Debug("Request unseal")
 
+	satscard.startPipeline()
+
+	// Fail before the CVC is used, as the card would refuse the command and delay the next attempt
+	if err := satscard.requireActiveSlotState("unseal", SlotSealed); err != nil {
+		return nil, err
+	}
+
 	if satscard.currentCardNonce == [16]byte{} {
 		satscard.queue.enqueue("status")
 	}
 
-	satscard.queue.enqueue("unseal")
-
-	satscard.cvc = cvc
+	satscard.enqueueAuthenticated("unseal", cvc)
 
 	return satscard.nextCommand()
 
@@ -27,6 +33,14 @@ func (satscard *Satscard) UnsealRequest(cvc string) ([]byte, error) {
 
 func (satscard *Satscard) unsealRequest() ([]byte, error) {
 
+	if err := satscard.requireActiveSlotState("unseal", SlotSealed); err != nil {
+
+		satscard.cvc = ""
+
+		return nil, err
+
+	}
+
 	command := command{Cmd: "unseal"}
 
 	auth, err := satscard.authenticate(satscard.cvc, command)
@@ -35,10 +49,13 @@ func (satscard *Satscard) unsealRequest() ([]byte, error) {
 		return nil, err
 	}
 
+	satscard.unsealSlot = satscard.ActiveSlot
+	satscard.unsealPending = true
+
 	unsealCommand := unsealCommand{
 		command: command,
 		auth:    *auth,
-		Slot:    satscard.ActiveSlot,
+		Slot:    satscard.unsealSlot,
 	}
 
 	return apduWrap(unsealCommand)
@@ -52,11 +69,20 @@ func (satscard *Satscard) parseUnsealData(unsealData unsealData) error {
 	slog.Debug("UNSEAL", "Slot", unsealData.Slot)
 	slog.Debug("UNSEAL", "PrivateKey", fmt.Sprintf("%x", unsealData.PrivateKey))
 	slog.Debug("UNSEAL", "PublicKey", fmt.Sprintf("%x", unsealData.PublicKey))
-	slog.Debug("UNSEAL", "MasterPublicKey", fmt.Sprintf("%x", unsealData.MasterPublicKey))
+	slog.Debug("UNSEAL", "MasterPrivateKey", fmt.Sprintf("%x", unsealData.MasterPrivateKey))
 	slog.Debug("UNSEAL", "ChainCode", fmt.Sprintf("%x", unsealData.ChainCode))
 	slog.Debug("UNSEAL", "CardNonce", fmt.Sprintf("%x", unsealData.CardNonce))
 
+	if err := satscard.rememberCardNonce(unsealData.CardNonce); err != nil {
+		return err
+	}
+
 	satscard.currentCardNonce = unsealData.CardNonce
+	satscard.unsealPending = false
+
+	if unsealData.Slot != satscard.unsealSlot {
+		return &UnsealVerificationError{Reason: fmt.Sprintf("card unsealed slot %d instead of slot %d", unsealData.Slot, satscard.unsealSlot)}
+	}
 
 	// Calculate and return private key as wif
 
@@ -67,6 +93,23 @@ func (satscard *Satscard) parseUnsealData(unsealData unsealData) error {
 
 	privateKey, _ := btcec.PrivKeyFromBytes(unencryptedPrivateKeyBytes)
 
+	// The public key verified by read must belong to the same slot
+	var readPublicKey [33]byte
+
+	if satscard.readSlot == unsealData.Slot {
+		readPublicKey = satscard.readPublicKey
+	}
+
+	err = verifySlotPrivateKey(privateKey, unsealData.PublicKey, readPublicKey, unsealData.MasterPrivateKey, unsealData.ChainCode)
+
+	if err != nil {
+		return err
+	}
+
+	if err := satscard.verifySlotChainCode(unsealData.Slot, unsealData.ChainCode); err != nil {
+		return err
+	}
+
 	// TODO support other than mainnet for development and testing purposes
 	wif, err := btcutil.NewWIF(privateKey, &chaincfg.MainNetParams, true)
 
@@ -76,6 +119,58 @@ func (satscard *Satscard) parseUnsealData(unsealData unsealData) error {
 
 	satscard.ActiveSlotPrivateKey = wif.String()
 
+	satscard.setSlotState(unsealData.Slot, SlotUnsealed)
+
+	if unsealData.Slot < len(satscard.slots) {
+
+		address, err := paymentAddress(unsealData.PublicKey)
+
+		if err != nil {
+			return err
+		}
+
+		satscard.slots[unsealData.Slot].publicKey = unsealData.PublicKey
+		satscard.slots[unsealData.Slot].address = address
+		satscard.slots[unsealData.Slot].privateKey = satscard.ActiveSlotPrivateKey
+
+	}
+
+	return nil
+
+}
+
+// verifySlotPrivateKey checks that a decrypted slot private key belongs to the public key reported
+// together with it, to the public key previously verified by read (unless zero), and that it is
+// derived as m/0 from the slot's master private key and chain code.
+func verifySlotPrivateKey(privateKey *btcec.PrivateKey, publicKey [33]byte, readPublicKey [33]byte, masterPrivateKey [32]byte, chainCode [32]byte) error {
+
+	var derivedPublicKey [33]byte
+	copy(derivedPublicKey[:], privateKey.PubKey().SerializeCompressed())
+
+	if derivedPublicKey != publicKey {
+		return &UnsealVerificationError{Reason: "private key does not match the reported public key"}
+	}
+
+	if readPublicKey != [33]byte{} && derivedPublicKey != readPublicKey {
+		return &UnsealVerificationError{Reason: "private key does not match the public key verified by read"}
+	}
+
+	masterKey := hdkeychain.NewExtendedKey(chaincfg.MainNetParams.HDPrivateKeyID[:], masterPrivateKey[:], chainCode[:], []byte{0, 0, 0, 0}, 0, 0, true)
+
+	childKey, err := masterKey.Derive(0)
+	if err != nil {
+		return &UnsealVerificationError{Reason: fmt.Sprintf("cannot derive slot key: %v", err)}
+	}
+
+	childPrivateKey, err := childKey.ECPrivKey()
+	if err != nil {
+		return &UnsealVerificationError{Reason: fmt.Sprintf("cannot derive slot key: %v", err)}
+	}
+
+	if !childPrivateKey.Key.Equals(&privateKey.Key) {
+		return &UnsealVerificationError{Reason: "private key is not derived from the master private key and chain code"}
+	}
+
 	return nil
 
 }
@@ -0,0 +1,198 @@
+package tapcards
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseUnsealDataRejects(t *testing.T) {
+
+	card := newSimulatedCard(t)
+
+	sessionKey := seededKey("session").Serialize()
+
+	// response returns the response of the card unsealing its first slot
+	response := func() unsealData {
+
+		slot := card.slots[0]
+
+		data := unsealData{Slot: 0}
+
+		copy(data.PrivateKey[:], encrypt(slot.privateKey, sessionKey))
+		copy(data.PublicKey[:], card.slotPublicKey(0))
+		copy(data.MasterPrivateKey[:], slot.masterKey)
+		copy(data.ChainCode[:], slot.chainCode)
+		copy(data.CardNonce[:], card.cardNonce)
+
+		return data
+
+	}
+
+	var otherPublicKey [33]byte
+	copy(otherPublicKey[:], seededKey("other").PubKey().SerializeCompressed())
+
+	tests := []struct {
+		name string
+		// tamper changes the response or the session before the response is parsed
+		tamper func(satscard *Satscard, data *unsealData)
+	}{
+		{"wrong slot", func(satscard *Satscard, data *unsealData) { data.Slot = 1 }},
+		{"private key not matching the public key", func(satscard *Satscard, data *unsealData) { data.PublicKey = otherPublicKey }},
+		{"private key not matching read", func(satscard *Satscard, data *unsealData) { satscard.readPublicKey = otherPublicKey }},
+		{"wrong session key", func(satscard *Satscard, data *unsealData) { satscard.sessionKey[0] ^= 1 }},
+		{"wrong master private key", func(satscard *Satscard, data *unsealData) { data.MasterPrivateKey[0] ^= 1 }},
+		{"wrong chain code", func(satscard *Satscard, data *unsealData) { data.ChainCode[0] ^= 1 }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			satscard := Satscard{NumberOfSlots: 10, slots: []slot{{state: SlotSealed}, {state: SlotUnused}}}
+
+			copy(satscard.sessionKey[:], sessionKey)
+			copy(satscard.readPublicKey[:], card.slotPublicKey(0))
+
+			data := response()
+
+			test.tamper(&satscard, &data)
+
+			var verificationError *UnsealVerificationError
+
+			if err := satscard.parseUnsealData(data); !errors.As(err, &verificationError) {
+				t.Fatalf("err = %v, want an UnsealVerificationError", err)
+			}
+
+			if satscard.ActiveSlotPrivateKey != "" || satscard.slots[0].privateKey != "" {
+				t.Error("private key handed out")
+			}
+
+			if satscard.ActiveSlotState() != SlotSealed {
+				t.Errorf("slot 0 is %v, want sealed", satscard.ActiveSlotState())
+			}
+
+		})
+	}
+
+	// The untampered response passes
+	satscard := Satscard{NumberOfSlots: 10, slots: []slot{{state: SlotSealed}, {state: SlotUnused}}}
+
+	copy(satscard.sessionKey[:], sessionKey)
+	copy(satscard.readPublicKey[:], card.slotPublicKey(0))
+
+	if err := satscard.parseUnsealData(response()); err != nil {
+		t.Fatal(err)
+	}
+
+	if satscard.ActiveSlotPrivateKey == "" || satscard.ActiveSlotState() != SlotUnsealed {
+		t.Errorf("private key %q, slot 0 %v", satscard.ActiveSlotPrivateKey, satscard.ActiveSlotState())
+	}
+
+}
+
+func TestChainCodeOnNew(t *testing.T) {
+
+	tests := []struct {
+		name string
+		// ignore makes the card set up the new slot without the chain code of the app
+		ignore bool
+		// restore persists and restores the session between new and unseal
+		restore bool
+		// dump reveals the slot with dump instead of unseal
+		dump bool
+	}{
+		{name: "unseal"},
+		{name: "dump", dump: true},
+		{name: "restored", restore: true},
+		{name: "ignored by unseal", ignore: true},
+		{name: "ignored by dump", ignore: true, dump: true},
+		{name: "ignored after restoring", ignore: true, restore: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			card := newSimulatedCard(t)
+			card.slots[0].state = SlotUnsealed
+
+			satscard := card.satscard()
+
+			tap(t, card, satscard)
+
+			if err := card.run(satscard, satscard.CertsRequest); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := card.run(satscard, func() ([]byte, error) { return satscard.NewRequest(card.cvc) }); err != nil {
+				t.Fatal(err)
+			}
+
+			if sent := satscard.slots[1].chainCode; len(sent) != 32 || !bytes.Equal(sent, card.slots[1].chainCode) {
+				t.Fatalf("chain code %x sent, card uses %x", sent, card.slots[1].chainCode)
+			}
+
+			if test.ignore {
+				card.slots[1] = card.newSlot(1, nil)
+			}
+
+			if test.restore {
+
+				state, err := satscard.MarshalBinary()
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				satscard = card.satscard()
+
+				if err := satscard.UnmarshalBinary(state); err != nil {
+					t.Fatal(err)
+				}
+
+			}
+
+			request := func() ([]byte, error) { return satscard.UnsealRequest(card.cvc) }
+
+			// The slot is unsealed elsewhere, and its private key is then dumped
+			if test.dump {
+				card.slots[1].state = SlotUnsealed
+				request = func() ([]byte, error) { return satscard.DumpRequest(1, card.cvc) }
+			}
+
+			tap(t, card, satscard)
+
+			err := card.run(satscard, request)
+
+			if !test.ignore {
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if want := slotWIF(t, card, 1); satscard.slots[1].privateKey != want {
+					t.Errorf("private key = %q, want %q", satscard.slots[1].privateKey, want)
+				}
+
+				return
+
+			}
+
+			var verificationError *UnsealVerificationError
+
+			if !errors.As(err, &verificationError) {
+				t.Fatalf("err = %v, want an UnsealVerificationError", err)
+			}
+
+			if !strings.Contains(verificationError.Reason, "chain code") {
+				t.Errorf("rejected because %s", verificationError.Reason)
+			}
+
+			if satscard.ActiveSlotPrivateKey != "" || satscard.slots[1].privateKey != "" {
+				t.Error("private key handed out")
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,252 @@
+package tapcards
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+)
+
+// VerificationReport describes every step of checking that a card is genuine.
+type VerificationReport struct {
+	// CardPublicKey is the hex encoded public key of the card.
+	CardPublicKey string `json:"card_public_key"`
+	// CertificateChainLength is the number of certificates in the card's chain.
+	CertificateChainLength int `json:"certificate_chain_length"`
+	// IntermediatePublicKeys are the hex encoded public keys recovered from the certificate chain,
+	// in order from the card towards the factory root, excluding the root itself.
+	IntermediatePublicKeys []string `json:"intermediate_public_keys"`
+	// FactoryRootPublicKey is the hex encoded public key at the end of the certificate chain.
+	FactoryRootPublicKey string `json:"factory_root_public_key"`
+	// FactoryRoot is the name of the trusted root that matched, or empty if none did.
+	FactoryRoot string `json:"factory_root"`
+	// CheckSignatureValid reports whether the card signed the check challenge with its public key.
+	CheckSignatureValid bool `json:"check_signature_valid"`
+	// ReadSignatureValid reports whether the slot signed the read challenge with its public key.
+	ReadSignatureValid bool `json:"read_signature_valid"`
+	// SlotPublicKeyCovered reports whether the check signature also covers the slot public key,
+	// binding the slot to the card.
+	SlotPublicKeyCovered bool `json:"slot_public_key_covered"`
+	// Slot is the slot that was read.
+	Slot int `json:"slot"`
+	// SlotPublicKey is the hex encoded public key of the slot that was read.
+	SlotPublicKey string `json:"slot_public_key"`
+	// Address is the payment address derived from the slot public key.
+	Address string `json:"address"`
+	// StatusAddress is the truncated address the card reported in status, if any.
+	StatusAddress string `json:"status_address"`
+	// AddressMatchesStatus reports whether Address matches StatusAddress.
+	AddressMatchesStatus bool `json:"address_matches_status"`
+	// Genuine reports whether the check signature is valid and the chain leads to a trusted root.
+	Genuine bool `json:"genuine"`
+}
+
+// signedChallenge is a nonce challenge sent to the card together with the signature it returned.
+type signedChallenge struct {
+	// cardNonce is the card nonce in effect when the challenge was sent.
+	cardNonce [16]byte
+	// appNonce is the nonce sent by the application.
+	appNonce []byte
+	// signature is the signature returned by the card.
+	signature [64]byte
+}
+
+// evidence is everything needed to decide whether a card is genuine.
+type evidence struct {
+	cardPublicKey    [33]byte
+	certificateChain [][65]byte
+	check            *signedChallenge
+	read             *signedChallenge
+	slot             int
+	slotPublicKey    [33]byte
+	statusAddress    string
+}
+
+// Verify returns a report on the genuineness of the card, based on the results of the
+// certs, read and check commands queued by CertsRequest.
+// It returns an error if the card has not been checked yet.
+func (satscard *Satscard) Verify() (*VerificationReport, error) {
+
+	if satscard.checkChallenge == nil {
+		return nil, errors.New("card not checked: run CertsRequest first")
+	}
+
+	return satscard.evidence().verify(satscard.trustStore())
+
+}
+
+// evidence collects the results of the verification commands run so far.
+func (satscard *Satscard) evidence() evidence {
+
+	return evidence{
+		cardPublicKey:    satscard.cardPublicKey,
+		certificateChain: satscard.certificateChain,
+		check:            satscard.checkChallenge,
+		read:             satscard.readChallenge,
+		slot:             satscard.readSlot,
+		slotPublicKey:    satscard.readPublicKey,
+		statusAddress:    satscard.ActiveSlotTruncatedPaymentAddress,
+	}
+}
+
+// verify checks the evidence against the trust store.
+// Failed checks are recorded in the report, an error is only returned for malformed evidence.
+func (evidence evidence) verify(trustStore *TrustStore) (*VerificationReport, error) {
+
+	report := VerificationReport{
+		CardPublicKey:          fmt.Sprintf("%x", evidence.cardPublicKey),
+		CertificateChainLength: len(evidence.certificateChain),
+		IntermediatePublicKeys: []string{},
+		StatusAddress:          evidence.statusAddress,
+	}
+
+	cardPublicKey, err := btcec.ParsePubKey(evidence.cardPublicKey[:])
+	if err != nil {
+		return nil, err
+	}
+
+	publicKeys, err := certificateChainPublicKeys(cardPublicKey, evidence.certificateChain)
+	if err != nil {
+		return nil, err
+	}
+
+	// The first key is the card's own, which is not recovered from the chain
+	for i := 1; i < len(publicKeys)-1; i++ {
+		report.IntermediatePublicKeys = append(report.IntermediatePublicKeys, fmt.Sprintf("%x", publicKeys[i].SerializeCompressed()))
+	}
+
+	factoryRootPublicKey := publicKeys[len(publicKeys)-1]
+	report.FactoryRootPublicKey = fmt.Sprintf("%x", factoryRootPublicKey.SerializeCompressed())
+
+	if len(evidence.certificateChain) > 0 {
+		report.FactoryRoot, _ = trustStore.match(factoryRootPublicKey)
+	}
+
+	var slotPublicKey []byte
+
+	if evidence.read != nil {
+
+		report.Slot = evidence.slot
+		report.SlotPublicKey = fmt.Sprintf("%x", evidence.slotPublicKey)
+		report.ReadSignatureValid = verifyReadSignature(evidence.slotPublicKey, evidence.slot, *evidence.read)
+
+		slotPublicKey = evidence.slotPublicKey[:]
+
+		report.Address, err = paymentAddress(evidence.slotPublicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		report.AddressMatchesStatus = matchesTruncatedAddress(report.Address, evidence.statusAddress)
+	}
+
+	if evidence.check != nil {
+		report.CheckSignatureValid, report.SlotPublicKeyCovered = verifyCheckSignature(cardPublicKey, slotPublicKey, *evidence.check)
+	}
+
+	report.Genuine = report.CheckSignatureValid && report.FactoryRoot != ""
+
+	return &report, nil
+
+}
+
+// certificateChainPublicKeys recovers the public keys that signed each certificate in the chain,
+// starting with the card public key. The last key returned is the root of the chain.
+func certificateChainPublicKeys(cardPublicKey *btcec.PublicKey, certificateChain [][65]byte) ([]*btcec.PublicKey, error) {
+
+	publicKeys := []*btcec.PublicKey{cardPublicKey}
+	publicKey := cardPublicKey
+
+	for i := 0; i < len(certificateChain); i++ {
+
+		var err error
+
+		publicKey, err = signatureToPublicKey(certificateChain[i], publicKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		publicKeys = append(publicKeys, publicKey)
+
+	}
+
+	return publicKeys, nil
+
+}
+
+// verifyCheckSignature verifies the signature returned by the check command.
+// The card includes the slot public key in the signed message when it is known to it,
+// so the signature is verified both with and without it. The second return value reports
+// whether the slot public key was covered by a valid signature.
+func verifyCheckSignature(cardPublicKey *btcec.PublicKey, slotPublicKey []byte, challenge signedChallenge) (bool, bool) {
+
+	message := append([]byte(openDime), challenge.cardNonce[:]...)
+	message = append(message, challenge.appNonce...)
+
+	if len(slotPublicKey) > 0 && verifySignature(challenge.signature, append(message, slotPublicKey...), cardPublicKey) {
+		return true, true
+	}
+
+	return verifySignature(challenge.signature, message, cardPublicKey), false
+
+}
+
+// verifyReadSignature verifies the signature returned by the read command with the slot public key.
+func verifyReadSignature(slotPublicKey [33]byte, slot int, challenge signedChallenge) bool {
+
+	publicKey, err := btcec.ParsePubKey(slotPublicKey[:])
+	if err != nil {
+		return false
+	}
+
+	message := append([]byte(openDime), challenge.cardNonce[:]...)
+	message = append(message, challenge.appNonce...)
+	message = append(message, byte(slot))
+
+	return verifySignature(challenge.signature, message, publicKey)
+
+}
+
+// verifySignature verifies a 64 byte compact signature over the SHA-256 digest of the message.
+func verifySignature(signature [64]byte, message []byte, publicKey *btcec.PublicKey) bool {
+
+	messageDigest := sha256.Sum256(message)
+
+	r := new(btcec.ModNScalar)
+	r.SetByteSlice(signature[0:32])
+
+	s := new(btcec.ModNScalar)
+	s.SetByteSlice(signature[32:64])
+
+	return ecdsa.NewSignature(r, s).Verify(messageDigest[:], publicKey)
+
+}
+
+// matchesTruncatedAddress reports whether the full address matches the abbreviated form
+// returned by status, where the middle of the address is replaced by underscores.
+// A form without underscores is compared as is.
+func matchesTruncatedAddress(address string, truncated string) bool {
+
+	start := strings.Index(truncated, "_")
+	end := strings.LastIndex(truncated, "_")
+
+	if start < 0 {
+		return address == truncated
+	}
+
+	if start == 0 || end == len(truncated)-1 {
+		return false
+	}
+
+	prefix := truncated[:start]
+	suffix := truncated[end+1:]
+
+	return len(prefix)+len(suffix) <= len(address) &&
+		strings.HasPrefix(address, prefix) &&
+		strings.HasSuffix(address, suffix)
+
+}
@@ -0,0 +1,165 @@
+package tapcards
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMatchesTruncatedAddress(t *testing.T) {
+
+	const address = "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq"
+
+	tests := []struct {
+		name      string
+		address   string
+		truncated string
+		want      bool
+	}{
+		{"truncated", address, "bc1qar0sr___f5mdq", true},
+		{"single underscore", address, "bc1qar0sr_f5mdq", true},
+		{"wrong prefix", address, "bc1qxr0sr___f5mdq", false},
+		{"wrong suffix", address, "bc1qar0sr___f5mdx", false},
+		{"longer than address", "bc1q", "bc1q___mdq", false},
+		{"no prefix", address, "___f5mdq", false},
+		{"no suffix", address, "bc1qar0sr___", false},
+		{"full address", address, address, true},
+		{"other full address", address, "bc1qxy2kgdygjrsqtzq2n0yrf2493p83kkfjhx0wlh", false},
+		{"both empty", "", "", true},
+		{"unknown address", "", "bc1qar0sr___f5mdq", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := matchesTruncatedAddress(test.address, test.truncated); got != test.want {
+				t.Errorf("matchesTruncatedAddress(%q, %q) = %v, want %v", test.address, test.truncated, got, test.want)
+			}
+		})
+	}
+
+}
+
+func TestVerify(t *testing.T) {
+
+	card := newSimulatedCard(t)
+	satscard := card.satscard()
+
+	if _, err := satscard.Verify(); err == nil {
+		t.Error("unchecked card verified")
+	}
+
+	if err := card.run(satscard, satscard.CertsRequest); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := satscard.Verify()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := VerificationReport{
+		CardPublicKey:          hex.EncodeToString(card.privateKey.PubKey().SerializeCompressed()),
+		CertificateChainLength: 2,
+		IntermediatePublicKeys: []string{hex.EncodeToString(seededKey("batch").PubKey().SerializeCompressed())},
+		FactoryRootPublicKey:   hex.EncodeToString(card.rootPublicKey),
+		FactoryRoot:            testRoot,
+		CheckSignatureValid:    true,
+		ReadSignatureValid:     true,
+		SlotPublicKeyCovered:   true,
+		Slot:                   0,
+		SlotPublicKey:          hex.EncodeToString(card.slotPublicKey(0)),
+		Address:                card.slotAddress(0),
+		StatusAddress:          satscard.ActiveSlotTruncatedPaymentAddress,
+		AddressMatchesStatus:   true,
+		Genuine:                true,
+	}
+
+	if !reflect.DeepEqual(*report, want) {
+		t.Errorf("report = %+v, want %+v", *report, want)
+	}
+
+	// A check signature that does not verify makes the card counterfeit
+	satscard.checkChallenge.signature[10] ^= 1
+
+	if report, err = satscard.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.CheckSignatureValid || report.SlotPublicKeyCovered || report.Genuine || !report.ReadSignatureValid {
+		t.Errorf("tampered check signature: %+v", *report)
+	}
+
+	// A read signature that does not verify is reported, but says nothing about the card itself
+	satscard.checkChallenge.signature[10] ^= 1
+	satscard.readChallenge.signature[10] ^= 1
+
+	if report, err = satscard.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.ReadSignatureValid || !report.CheckSignatureValid || !report.Genuine {
+		t.Errorf("tampered read signature: %+v", *report)
+	}
+
+}
+
+// TestVerifyWithoutRead verifies a card whose active slot is unsealed, so read did not run.
+func TestVerifyWithoutRead(t *testing.T) {
+
+	card := newSimulatedCard(t)
+	card.slots[0].state = SlotUnsealed
+
+	satscard := card.satscard()
+
+	if err := card.run(satscard, satscard.CertsRequest); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"status", "certs", "check"}; !reflect.DeepEqual(card.commands, want) {
+		t.Errorf("commands = %v, want %v", card.commands, want)
+	}
+
+	report, err := satscard.Verify()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.Genuine || !report.CheckSignatureValid || report.FactoryRoot != testRoot {
+		t.Errorf("card not verified: %+v", *report)
+	}
+
+	if report.ReadSignatureValid || report.SlotPublicKeyCovered || report.SlotPublicKey != "" || report.Address != "" || report.AddressMatchesStatus {
+		t.Errorf("report covers a read that did not run: %+v", *report)
+	}
+
+}
+
+func TestVerifyUntrustedRoot(t *testing.T) {
+
+	card := newSimulatedCard(t)
+
+	satscard := NewSatscard()
+	satscard.TrustStore = NewTrustStore()
+
+	if err := card.run(satscard, satscard.CertsRequest); !errors.Is(err, ErrUntrustedFactoryRoot) {
+		t.Fatalf("err = %v, want %v", err, ErrUntrustedFactoryRoot)
+	}
+
+	report, err := satscard.Verify()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Genuine || report.FactoryRoot != "" || !report.CheckSignatureValid {
+		t.Errorf("untrusted root: %+v", *report)
+	}
+
+	if report.FactoryRootPublicKey != hex.EncodeToString(card.rootPublicKey) {
+		t.Errorf("factory root public key = %s, want %x", report.FactoryRootPublicKey, card.rootPublicKey)
+	}
+
+}
@@ -8,6 +8,8 @@ func (satscard *Satscard) WaitRequest() ([]byte, error) {
 
 	slog.Debug("Request wait")
 
+	satscard.startPipeline()
+
 	if satscard.currentCardNonce == [16]byte{} {
 		satscard.queue.enqueue("status")
 	}
@@ -33,7 +35,7 @@ func (satscard *Satscard) parseWaitData(waitData waitData) error {
 	slog.Debug("WAIT", "Success", waitData.Success)
 	slog.Debug("WAIT", "AuthDelay", waitData.AuthDelay)
 
-	satscard.AuthDelay = waitData.AuthDelay
+	satscard.setAuthDelay(waitData.AuthDelay)
 
 	return nil
 